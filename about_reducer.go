@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// AboutValue is one claim about a field of a profile, like the name of a feed
+type AboutValue struct {
+	Value   string
+	Author  FeedRef
+	Key     MessageRef
+	Claimed time.Time
+}
+
+// AboutField holds the latest claim of every author about one field of a profile
+type AboutField struct {
+	// Self is the latest value the feed assigned to itself, if any.
+	// Only feeds can assign values to themselves.
+	Self *AboutValue
+
+	// Others are the latest values that other feeds assigned, the newest first
+	Others []AboutValue
+}
+
+// Popular returns the values that others assigned, the one used by the most authors first.
+// Values that are used equally often are ordered by their latest claim, the newest first.
+func (af AboutField) Popular() []string {
+	var (
+		counts = make(map[string]int)
+		latest = make(map[string]time.Time)
+		values []string
+	)
+	for _, v := range af.Others {
+		if _, has := counts[v.Value]; !has {
+			values = append(values, v.Value)
+		}
+		counts[v.Value]++
+		if v.Claimed.After(latest[v.Value]) {
+			latest[v.Value] = v.Claimed
+		}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		a, b := values[i], values[j]
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return latest[a].After(latest[b])
+	})
+	return values
+}
+
+// Current returns the value that should be shown:
+// the self-assigned one if there is one, otherwise the most popular one others assigned.
+func (af AboutField) Current() string {
+	if af.Self != nil {
+		return af.Self.Value
+	}
+	if popular := af.Popular(); len(popular) > 0 {
+		return popular[0]
+	}
+	return ""
+}
+
+// Profile is the current state of a feed, message or channel, as reduced from about messages
+type Profile struct {
+	About AnyRef
+
+	Name        string
+	Description string
+	Image       *BlobRef
+
+	Names        AboutField
+	Descriptions AboutField
+	Images       AboutField
+}
+
+// AboutReducer ingests about messages and resolves the current profile of the things they are about.
+// Of each author only the about message with the latest claimed timestamp counts, per field.
+// It is safe for concurrent use.
+type AboutReducer struct {
+	mu sync.RWMutex
+
+	abouts map[AnyRef]*aboutClaims
+}
+
+// aboutClaims holds the latest claim of every author per field
+type aboutClaims struct {
+	names, descriptions, images map[FeedRef]AboutValue
+}
+
+// NewAboutReducer returns an empty reducer
+func NewAboutReducer() *AboutReducer {
+	return &AboutReducer{
+		abouts: make(map[AnyRef]*aboutClaims),
+	}
+}
+
+// Add ingests the about message with the passed key of author, which claims to be written at the passed time.
+// The order in which messages are added doesn't matter.
+// If two messages of an author claim the same time, the one with the greater key (by sigil) counts.
+// Channels are normalized like the ChannelTracker does it, an invalid channel name returns ErrInvalidChannel.
+func (ar *AboutReducer) Add(author FeedRef, key MessageRef, claimed time.Time, a About) error {
+	about, err := normalizeAboutRef(a.About)
+	if err != nil {
+		return err
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	claims, has := ar.abouts[about]
+	if !has {
+		claims = &aboutClaims{
+			names:        make(map[FeedRef]AboutValue),
+			descriptions: make(map[FeedRef]AboutValue),
+			images:       make(map[FeedRef]AboutValue),
+		}
+		ar.abouts[about] = claims
+	}
+
+	set := func(field map[FeedRef]AboutValue, value string) {
+		if value == "" {
+			return
+		}
+		if old, has := field[author]; has {
+			if claimed.Before(old.Claimed) {
+				return
+			}
+			if claimed.Equal(old.Claimed) && key.Sigil() <= old.Key.Sigil() {
+				return
+			}
+		}
+		field[author] = AboutValue{Value: value, Author: author, Key: key, Claimed: claimed}
+	}
+
+	set(claims.names, a.Name)
+	set(claims.descriptions, a.Description)
+	if a.Image != nil {
+		set(claims.images, a.Image.Sigil())
+	}
+	return nil
+}
+
+// normalizeAboutRef normalizes channel names, so that #SSB and #ssb are the same channel
+func normalizeAboutRef(about AnyRef) (AnyRef, error) {
+	ch, ok := about.IsChannel()
+	if !ok {
+		return about, nil
+	}
+	return NewChannelRef(ch)
+}
+
+// Get returns the current profile of a feed, message or channel.
+// The second return value is false if no about message was added for it.
+func (ar *AboutReducer) Get(about AnyRef) (Profile, bool) {
+	p := Profile{About: about}
+
+	about, err := normalizeAboutRef(about)
+	if err != nil {
+		return p, false
+	}
+	p.About = about
+
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	claims, has := ar.abouts[about]
+	if !has {
+		return p, false
+	}
+
+	self, isFeed := about.IsFeed()
+
+	field := func(values map[FeedRef]AboutValue) AboutField {
+		var af AboutField
+		for author, v := range values {
+			if isFeed && author.Equal(self) {
+				v := v
+				af.Self = &v
+				continue
+			}
+			af.Others = append(af.Others, v)
+		}
+		sort.Slice(af.Others, func(i, j int) bool {
+			a, b := af.Others[i], af.Others[j]
+			if !a.Claimed.Equal(b.Claimed) {
+				return a.Claimed.After(b.Claimed)
+			}
+			return feedLess(a.Author, b.Author)
+		})
+		return af
+	}
+
+	p.Names = field(claims.names)
+	p.Descriptions = field(claims.descriptions)
+	p.Images = field(claims.images)
+
+	p.Name = p.Names.Current()
+	p.Description = p.Descriptions.Current()
+	if img := p.Images.Current(); img != "" {
+		if br, err := ParseBlobRef(img); err == nil {
+			p.Image = &br
+		}
+	}
+
+	return p, true
+}
+
+// GetFeed is a shorthand for Get with a feed
+func (ar *AboutReducer) GetFeed(feed FeedRef) (Profile, bool) {
+	return ar.Get(AnyRef{r: feed})
+}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAboutUnmarshal(t *testing.T) {
+	r := require.New(t)
+
+	var a About
+	err := json.Unmarshal([]byte(`{"type":"about","about":"%AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=.sha256","name":"party"}`), &a)
+	r.NoError(err)
+	_, ok := a.About.IsMessage()
+	r.True(ok)
+	r.Equal("party", a.Name)
+	_, ok = a.Feed()
+	r.False(ok)
+
+	err = json.Unmarshal([]byte(`{"type":"about","about":"#ssb","description":"all about ssb"}`), &a)
+	r.NoError(err)
+	ch, ok := a.About.IsChannel()
+	r.True(ok)
+	r.Equal("#ssb", ch)
+	r.Equal("all about ssb", a.Description)
+
+	alice := newTestFeed('a')
+	out, err := json.Marshal(NewAboutName(alice, "alice"))
+	r.NoError(err)
+	r.NoError(json.Unmarshal(out, &a))
+	feed, ok := a.Feed()
+	r.True(ok)
+	r.True(feed.Equal(alice))
+
+	err = json.Unmarshal([]byte(`{"type":"about","about":"nope"}`), &a)
+	r.Error(err)
+}
+
+func TestAboutReducer(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		alice  = newTestFeed('a')
+		bob    = newTestFeed('b')
+		claire = newTestFeed('c')
+		dave   = newTestFeed('d')
+	)
+
+	start := time.Unix(1600000000, 0)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+	aboutKey := func(i int) MessageRef { return fakeRef(fmt.Sprintf("about%d", i)) }
+
+	img, err := ParseBlobRef("&AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=.sha256")
+	r.NoError(err)
+
+	ar := NewAboutReducer()
+
+	_, has := ar.GetFeed(alice)
+	r.False(has)
+
+	// others name alice before she does
+	r.NoError(ar.Add(bob, aboutKey(1), at(1), *NewAboutName(alice, "ally")))
+	r.NoError(ar.Add(claire, aboutKey(2), at(2), *NewAboutName(alice, "ally")))
+	r.NoError(ar.Add(dave, aboutKey(3), at(3), *NewAboutName(alice, "a")))
+
+	p, has := ar.GetFeed(alice)
+	r.True(has)
+	r.Equal("ally", p.Name, "most popular")
+	r.Nil(p.Names.Self)
+	r.Equal([]string{"ally", "a"}, p.Names.Popular())
+	r.Len(p.Names.Others, 3)
+	r.Equal(dave, p.Names.Others[0].Author, "newest first")
+
+	// bob changes his mind, now it's a tie which the newer claim wins
+	r.NoError(ar.Add(bob, aboutKey(4), at(4), *NewAboutName(alice, "a")))
+	p, _ = ar.GetFeed(alice)
+	r.Equal("a", p.Name)
+
+	// an older claim doesn't overwrite a newer one, no matter the order they are added in
+	r.NoError(ar.Add(bob, aboutKey(5), at(0), *NewAboutName(alice, "ally")))
+	p, _ = ar.GetFeed(alice)
+	r.Equal("a", p.Name)
+
+	// self-assigned wins
+	r.NoError(ar.Add(alice, aboutKey(6), at(5), *NewAboutName(alice, "alice")))
+	r.NoError(ar.Add(alice, aboutKey(7), at(6), *NewAboutImage(alice, &img)))
+	p, _ = ar.GetFeed(alice)
+	r.Equal("alice", p.Name)
+	r.NotNil(p.Names.Self)
+	r.Equal(at(5), p.Names.Self.Claimed)
+	r.NotNil(p.Image)
+	r.True(p.Image.Equal(img))
+	r.Equal([]string{"a", "ally"}, p.Names.Popular())
+
+	// nobody set a description
+	r.Equal("", p.Description)
+	r.Nil(p.Descriptions.Self)
+
+	// about a channel, nobody is self
+	r.NoError(ar.Add(alice, aboutKey(8), at(1), About{Type: "about", About: AnyRef{channel: "#ssb"}, Description: "scuttlebutt"}))
+	r.NoError(ar.Add(bob, aboutKey(9), at(2), About{Type: "about", About: AnyRef{channel: "#ssb"}, Description: "the protocol"}))
+	p, has = ar.Get(AnyRef{channel: "#ssb"})
+	r.True(has)
+	r.Equal("the protocol", p.Description)
+	r.Nil(p.Descriptions.Self)
+	r.Len(p.Descriptions.Others, 2)
+
+	// channels are normalized like in the ChannelTracker
+	r.NoError(ar.Add(claire, aboutKey(10), at(3), About{Type: "about", About: AnyRef{channel: "#SSB"}, Description: "secure scuttlebutt"}))
+	p, has = ar.Get(AnyRef{channel: "# Ssb"})
+	r.True(has)
+	ch, _ := p.About.IsChannel()
+	r.Equal("#ssb", ch)
+	r.Equal("secure scuttlebutt", p.Description)
+	r.Len(p.Descriptions.Others, 3)
+
+	err = ar.Add(claire, aboutKey(11), at(4), About{Type: "about", About: AnyRef{channel: "#?!"}, Description: "nothing"})
+	r.True(errors.Is(err, ErrInvalidChannel))
+	_, has = ar.Get(AnyRef{channel: "#?!"})
+	r.False(has)
+}
+
+func TestAboutReducerSameClaimedTime(t *testing.T) {
+	var (
+		alice = newTestFeed('a')
+		bob   = newTestFeed('b')
+
+		claimed = time.Unix(1600000000, 0)
+		lower   = fakeRef("about1")
+		greater = fakeRef("about2")
+	)
+
+	type claim struct {
+		key  MessageRef
+		name string
+	}
+	orders := [][]claim{
+		{{lower, "ally"}, {greater, "al"}},
+		{{greater, "al"}, {lower, "ally"}},
+	}
+
+	for i, order := range orders {
+		ar := NewAboutReducer()
+		for _, c := range order {
+			require.NoError(t, ar.Add(bob, c.key, claimed, *NewAboutName(alice, c.name)))
+		}
+
+		p, _ := ar.GetFeed(alice)
+		require.Equal(t, "al", p.Name, "order %d", i)
+		require.Len(t, p.Names.Others, 1, "order %d", i)
+		require.True(t, p.Names.Others[0].Key.Equal(greater), "order %d", i)
+	}
+}
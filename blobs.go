@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// DefaultMaxBlobSize is the size limit of blobs the js stack uses (5MB)
+const DefaultMaxBlobSize = 5 * 1024 * 1024
+
+// Errors of the VerifyingReader
+var (
+	ErrBlobTooLarge = errors.New("ssb/blobs: blob is too large")
+	ErrBlobMismatch = errors.New("ssb/blobs: content doesn't match the reference")
+)
+
+// NewBlobRefFromReader reads r until EOF and returns the reference of the content and its size
+func NewBlobRefFromReader(r io.Reader) (BlobRef, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return BlobRef{}, n, fmt.Errorf("ssb/blobs: failed to read content: %w", err)
+	}
+
+	br, err := NewBlobRefFromBytes(h.Sum(nil), RefAlgoBlobSSB1)
+	return br, n, err
+}
+
+// VerifyingReader passes through the content of a blob and makes sure it matches the reference.
+// When the underlying reader is done, Read returns ErrBlobMismatch instead of io.EOF if the content has a different hash.
+// It returns ErrBlobTooLarge as soon as more than the maximum size is read.
+// Only once Read returned io.EOF, the content can be trusted.
+type VerifyingReader struct {
+	r    io.Reader
+	want BlobRef
+
+	h       hash.Hash
+	n, max  int64
+	lastErr error
+}
+
+// NewVerifyingReader wraps r, which should return the content of want.
+// If maxSize is zero or negative, DefaultMaxBlobSize is used.
+func NewVerifyingReader(r io.Reader, want BlobRef, maxSize int64) (*VerifyingReader, error) {
+	if err := want.IsValid(); err != nil {
+		return nil, err
+	}
+
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBlobSize
+	}
+
+	return &VerifyingReader{
+		r:    r,
+		want: want,
+		h:    sha256.New(),
+		max:  maxSize,
+	}, nil
+}
+
+// Read implements io.Reader
+func (vr *VerifyingReader) Read(p []byte) (int, error) {
+	if vr.lastErr != nil {
+		return 0, vr.lastErr
+	}
+
+	// read at most one byte more than allowed, to notice blobs that are too large
+	if left := vr.max - vr.n + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+
+	n, err := vr.r.Read(p)
+	vr.n += int64(n)
+
+	if vr.n > vr.max {
+		n -= int(vr.n - vr.max)
+		vr.lastErr = fmt.Errorf("%w: more than %d bytes", ErrBlobTooLarge, vr.max)
+		vr.h.Write(p[:n])
+		return n, vr.lastErr
+	}
+	vr.h.Write(p[:n])
+
+	if err == io.EOF {
+		got, refErr := NewBlobRefFromBytes(vr.h.Sum(nil), RefAlgoBlobSSB1)
+		if refErr != nil {
+			err = refErr
+		} else if !got.Equal(vr.want) {
+			err = fmt.Errorf("%w: got %s, wanted %s", ErrBlobMismatch, got.ShortSigil(), vr.want.ShortSigil())
+		}
+	}
+	if err != nil {
+		vr.lastErr = err
+	}
+	return n, err
+}
+
+// Size returns the number of bytes that were read so far
+func (vr *VerifyingReader) Size() int64 {
+	return vr.n
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBlobRefFromReader(t *testing.T) {
+	r := require.New(t)
+
+	// the hash of the empty blob
+	br, n, err := NewBlobRefFromReader(strings.NewReader(""))
+	r.NoError(err)
+	r.EqualValues(0, n)
+	r.Equal("&47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=.sha256", br.Sigil())
+
+	content := bytes.Repeat([]byte("hello, world!"), 1000)
+	br, n, err = NewBlobRefFromReader(iotest.OneByteReader(bytes.NewReader(content)))
+	r.NoError(err)
+	r.EqualValues(len(content), n)
+
+	sum := sha256.Sum256(content)
+	want, err := NewBlobRefFromBytes(sum[:], RefAlgoBlobSSB1)
+	r.NoError(err)
+	r.True(want.Equal(br))
+
+	_, _, err = NewBlobRefFromReader(iotest.TimeoutReader(strings.NewReader("not empty")))
+	r.Error(err)
+}
+
+func TestVerifyingReader(t *testing.T) {
+	r := require.New(t)
+
+	content := bytes.Repeat([]byte{1, 2, 3, 4}, 256)
+	br, _, err := NewBlobRefFromReader(bytes.NewReader(content))
+	r.NoError(err)
+
+	// correct content
+	vr, err := NewVerifyingReader(bytes.NewReader(content), br, 0)
+	r.NoError(err)
+	got, err := ioutil.ReadAll(vr)
+	r.NoError(err)
+	r.Equal(content, got)
+	r.EqualValues(len(content), vr.Size())
+
+	// exactly at the limit is fine
+	vr, err = NewVerifyingReader(iotest.HalfReader(bytes.NewReader(content)), br, int64(len(content)))
+	r.NoError(err)
+	got, err = ioutil.ReadAll(vr)
+	r.NoError(err)
+	r.Equal(content, got)
+
+	// different content
+	changed := append([]byte{}, content...)
+	changed[100] = 0
+	vr, err = NewVerifyingReader(bytes.NewReader(changed), br, 0)
+	r.NoError(err)
+	_, err = ioutil.ReadAll(vr)
+	r.True(errors.Is(err, ErrBlobMismatch), "%v", err)
+
+	// truncated content
+	vr, err = NewVerifyingReader(bytes.NewReader(content[:10]), br, 0)
+	r.NoError(err)
+	_, err = ioutil.ReadAll(vr)
+	r.True(errors.Is(err, ErrBlobMismatch), "%v", err)
+
+	// over the limit
+	vr, err = NewVerifyingReader(bytes.NewReader(content), br, 100)
+	r.NoError(err)
+	got, err = ioutil.ReadAll(vr)
+	r.True(errors.Is(err, ErrBlobTooLarge), "%v", err)
+	r.Len(got, 100)
+
+	// the error sticks
+	_, err = vr.Read(make([]byte, 10))
+	r.True(errors.Is(err, ErrBlobTooLarge))
+
+	_, err = NewVerifyingReader(bytes.NewReader(content), BlobRef{}, 0)
+	r.Error(err)
+}
@@ -0,0 +1,315 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+// Package blobstore implements a content-addressed store for blobs on the filesystem.
+//
+// It uses the same layout as multiblob of the js stack: <root>/sha256/<first byte of the hash as hex>/<rest of the hash as hex>,
+// so that it can work on an existing ~/.ssb/blobs directory.
+package blobstore
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// ErrNoSuchBlob is returned if the store doesn't have the requested blob
+var ErrNoSuchBlob = errors.New("blobstore: no such blob")
+
+// Op is the kind of change to the store
+type Op int
+
+// The possible changes
+const (
+	OpPut Op = iota + 1
+	OpDelete
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+}
+
+// Notification tells subscribers of Changes about a blob that was added or removed
+type Notification struct {
+	Op   Op
+	Ref  refs.BlobRef
+	Size int64
+}
+
+// changesBuffer is the number of notifications that are kept for slow subscribers, before new ones are dropped
+const changesBuffer = 64
+
+// Store is a blob store on the filesystem. It is safe for concurrent use.
+type Store struct {
+	root    string
+	maxSize int64
+
+	mu   sync.Mutex
+	subs map[chan Notification]struct{}
+}
+
+// New opens the store at root and creates the directories it needs.
+// Blobs larger than maxSize are rejected. If it is zero or negative, refs.DefaultMaxBlobSize is used.
+func New(root string, maxSize int64) (*Store, error) {
+	for _, dir := range []string{"sha256", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0700); err != nil {
+			return nil, fmt.Errorf("blobstore: failed to create %s directory: %w", dir, err)
+		}
+	}
+
+	if maxSize <= 0 {
+		maxSize = refs.DefaultMaxBlobSize
+	}
+
+	return &Store{
+		root:    root,
+		maxSize: maxSize,
+		subs:    make(map[chan Notification]struct{}),
+	}, nil
+}
+
+// Path returns the location of the blob in the store, which might not exist
+func (s *Store) Path(ref refs.BlobRef) (string, error) {
+	if err := ref.IsValid(); err != nil {
+		return "", fmt.Errorf("blobstore: %w", err)
+	}
+
+	var hash [32]byte
+	if err := ref.CopyHashTo(hash[:]); err != nil {
+		return "", err
+	}
+
+	hexHash := hex.EncodeToString(hash[:])
+	return filepath.Join(s.root, "sha256", hexHash[:2], hexHash[2:]), nil
+}
+
+// Put stores the content that r returns and returns the reference of it
+func (s *Store) Put(r io.Reader) (refs.BlobRef, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(s.root, "tmp"), "put")
+	if err != nil {
+		return refs.BlobRef{}, fmt.Errorf("blobstore: failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// read one more byte than allowed, to notice blobs that are too large
+	limited := io.LimitReader(r, s.maxSize+1)
+	ref, n, err := refs.NewBlobRefFromReader(io.TeeReader(limited, tmp))
+	if err != nil {
+		tmp.Close()
+		return refs.BlobRef{}, fmt.Errorf("blobstore: %w", err)
+	}
+	if n > s.maxSize {
+		tmp.Close()
+		return refs.BlobRef{}, fmt.Errorf("blobstore: %w: more than %d bytes", refs.ErrBlobTooLarge, s.maxSize)
+	}
+
+	if err := s.commit(tmp, ref, n); err != nil {
+		return refs.BlobRef{}, err
+	}
+	return ref, nil
+}
+
+// PutExpected stores the content that r returns, if it matches want.
+// Otherwise it returns refs.ErrBlobMismatch and the store is not changed.
+func (s *Store) PutExpected(r io.Reader, want refs.BlobRef) error {
+	vr, err := refs.NewVerifyingReader(r, want, s.maxSize)
+	if err != nil {
+		return fmt.Errorf("blobstore: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Join(s.root, "tmp"), "put")
+	if err != nil {
+		return fmt.Errorf("blobstore: failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, vr); err != nil {
+		tmp.Close()
+		return fmt.Errorf("blobstore: %w", err)
+	}
+
+	return s.commit(tmp, want, vr.Size())
+}
+
+// commit moves the verified temporary file into place and notifies the subscribers
+func (s *Store) commit(tmp *os.File, ref refs.BlobRef, size int64) error {
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("blobstore: failed to write temporary file: %w", err)
+	}
+
+	p, err := s.Path(ref)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return fmt.Errorf("blobstore: failed to create directory: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("blobstore: failed to move blob into place: %w", err)
+	}
+
+	s.notify(Notification{Op: OpPut, Ref: ref, Size: size})
+	return nil
+}
+
+// Get opens the blob for reading
+func (s *Store) Get(ref refs.BlobRef) (io.ReadCloser, error) {
+	p, err := s.Path(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNoSuchBlob
+	}
+	if err != nil {
+		return nil, fmt.Errorf("blobstore: failed to open blob: %w", err)
+	}
+	return f, nil
+}
+
+// Has returns true if the store has the blob
+func (s *Store) Has(ref refs.BlobRef) (bool, error) {
+	_, err := s.Size(ref)
+	if errors.Is(err, ErrNoSuchBlob) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Size returns the size of the blob in bytes
+func (s *Store) Size(ref refs.BlobRef) (int64, error) {
+	p, err := s.Path(ref)
+	if err != nil {
+		return 0, err
+	}
+
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return 0, ErrNoSuchBlob
+	}
+	if err != nil {
+		return 0, fmt.Errorf("blobstore: failed to stat blob: %w", err)
+	}
+	return fi.Size(), nil
+}
+
+// List returns all the blobs in the store, sorted by their hash.
+// Files that don't fit the layout are skipped.
+func (s *Store) List() ([]refs.BlobRef, error) {
+	base := filepath.Join(s.root, "sha256")
+
+	dirs, err := ioutil.ReadDir(base)
+	if err != nil {
+		return nil, fmt.Errorf("blobstore: failed to list blobs: %w", err)
+	}
+
+	var blobs []refs.BlobRef
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(base, dir.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("blobstore: failed to list blobs: %w", err)
+		}
+
+		for _, f := range files {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+
+			hash, err := hex.DecodeString(dir.Name() + f.Name())
+			if err != nil || len(hash) != 32 {
+				continue
+			}
+
+			ref, err := refs.NewBlobRefFromBytes(hash, refs.RefAlgoBlobSSB1)
+			if err != nil {
+				continue
+			}
+			blobs = append(blobs, ref)
+		}
+	}
+
+	// ReadDir sorts by name, so the list is already sorted by hash
+	return blobs, nil
+}
+
+// Delete removes the blob from the store
+func (s *Store) Delete(ref refs.BlobRef) error {
+	p, err := s.Path(ref)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return ErrNoSuchBlob
+	}
+	if err != nil {
+		return fmt.Errorf("blobstore: failed to stat blob: %w", err)
+	}
+
+	if err := os.Remove(p); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoSuchBlob
+		}
+		return fmt.Errorf("blobstore: failed to delete blob: %w", err)
+	}
+
+	s.notify(Notification{Op: OpDelete, Ref: ref, Size: fi.Size()})
+	return nil
+}
+
+// Changes returns a channel that gets a notification for every blob that is added or removed, and a function to stop the notifications.
+// The channel is buffered. If a subscriber doesn't keep up, new notifications for it are dropped instead of blocking the store.
+func (s *Store) Changes() (<-chan Notification, func()) {
+	ch := make(chan Notification, changesBuffer)
+
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subs, ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+func (s *Store) notify(n Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subs {
+		select {
+		case ch <- n:
+		default:
+		}
+	}
+}
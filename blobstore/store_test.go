@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+func newTestStore(t *testing.T, maxSize int64) (*Store, string) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s, err := New(dir, maxSize)
+	require.NoError(t, err)
+	return s, dir
+}
+
+func TestStore(t *testing.T) {
+	r := require.New(t)
+
+	s, dir := newTestStore(t, 0)
+
+	changes, cancel := s.Changes()
+	defer cancel()
+
+	list, err := s.List()
+	r.NoError(err)
+	r.Empty(list)
+
+	// the empty blob, to check the layout
+	empty, err := s.Put(strings.NewReader(""))
+	r.NoError(err)
+	r.Equal("&47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=.sha256", empty.Sigil())
+	_, err = os.Stat(filepath.Join(dir, "sha256", "e3", "b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+	r.NoError(err)
+
+	n := <-changes
+	r.Equal(OpPut, n.Op)
+	r.True(n.Ref.Equal(empty))
+	r.EqualValues(0, n.Size)
+
+	content := []byte("hello, blobs!")
+	hello, err := s.Put(bytes.NewReader(content))
+	r.NoError(err)
+	<-changes
+
+	has, err := s.Has(hello)
+	r.NoError(err)
+	r.True(has)
+
+	size, err := s.Size(hello)
+	r.NoError(err)
+	r.EqualValues(len(content), size)
+
+	rc, err := s.Get(hello)
+	r.NoError(err)
+	got, err := ioutil.ReadAll(rc)
+	r.NoError(err)
+	r.NoError(rc.Close())
+	r.Equal(content, got)
+
+	list, err = s.List()
+	r.NoError(err)
+	r.Len(list, 2)
+
+	r.NoError(s.Delete(hello))
+	n = <-changes
+	r.Equal(OpDelete, n.Op)
+	r.True(n.Ref.Equal(hello))
+	r.EqualValues(len(content), n.Size)
+
+	has, err = s.Has(hello)
+	r.NoError(err)
+	r.False(has)
+
+	_, err = s.Get(hello)
+	r.True(errors.Is(err, ErrNoSuchBlob))
+	_, err = s.Size(hello)
+	r.True(errors.Is(err, ErrNoSuchBlob))
+	r.True(errors.Is(s.Delete(hello), ErrNoSuchBlob))
+
+	// put with verification
+	r.NoError(s.PutExpected(bytes.NewReader(content), hello))
+	has, err = s.Has(hello)
+	r.NoError(err)
+	r.True(has)
+	<-changes
+
+	err = s.PutExpected(strings.NewReader("something else"), empty)
+	r.True(errors.Is(err, refs.ErrBlobMismatch), "%v", err)
+	size, err = s.Size(empty)
+	r.NoError(err)
+	r.EqualValues(0, size)
+
+	// files that don't belong to the store are skipped
+	r.NoError(ioutil.WriteFile(filepath.Join(dir, "sha256", "e3", "nothex"), nil, 0600))
+	list, err = s.List()
+	r.NoError(err)
+	r.Len(list, 2)
+
+	// the temporary files are cleaned up
+	tmps, err := ioutil.ReadDir(filepath.Join(dir, "tmp"))
+	r.NoError(err)
+	r.Empty(tmps)
+
+	cancel()
+	_, open := <-changes
+	r.False(open)
+
+	// no notifications after cancel
+	_, err = s.Put(strings.NewReader("after"))
+	r.NoError(err)
+}
+
+func TestStoreMaxSize(t *testing.T) {
+	r := require.New(t)
+
+	s, _ := newTestStore(t, 10)
+
+	_, err := s.Put(strings.NewReader("exactly 10"))
+	r.NoError(err)
+
+	_, err = s.Put(strings.NewReader("more than 10"))
+	r.True(errors.Is(err, refs.ErrBlobTooLarge), "%v", err)
+
+	ref, _, err := refs.NewBlobRefFromReader(strings.NewReader("more than 10"))
+	r.NoError(err)
+	err = s.PutExpected(strings.NewReader("more than 10"), ref)
+	r.True(errors.Is(err, refs.ErrBlobTooLarge), "%v", err)
+
+	has, err := s.Has(ref)
+	r.NoError(err)
+	r.False(has)
+}
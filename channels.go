@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+)
+
+// ErrInvalidChannel is returned for channel names that are empty after normalization
+var ErrInvalidChannel = errors.New("ssb: invalid channel name")
+
+// MaxChannelLength is the limit for the length of normalized channel names, which need to be shorter than it.
+// Like in javascript, the length is counted in UTF-16 code units.
+const MaxChannelLength = 30
+
+// NormalizeChannel returns the name like ssb-ref normalizes it: lowercase, without whitespace, # and punctuation like ,.?!<>()[]".
+// It returns ErrInvalidChannel if nothing is left of the name or if it is not shorter than MaxChannelLength,
+// since ssb-ref doesn't accept those either.
+func NormalizeChannel(name string) (string, error) {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || strings.ContainsRune(`,.?!<>()[]"#`, r) {
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+
+	if name == "" {
+		return "", ErrInvalidChannel
+	}
+	if n := len(utf16.Encode([]rune(name))); n >= MaxChannelLength {
+		return "", fmt.Errorf("%w: %d characters long", ErrInvalidChannel, n)
+	}
+	return name, nil
+}
+
+// NewChannelRef returns the normalized channel as an AnyRef, for instance to use it as the about field of an About message
+func NewChannelRef(name string) (AnyRef, error) {
+	name, err := NormalizeChannel(name)
+	if err != nil {
+		return AnyRef{}, err
+	}
+	return AnyRef{channel: "#" + name}, nil
+}
+
+// Channel (un)subscribes the author to a channel (type:channel)
+type Channel struct {
+	Type       string `json:"type"`
+	Channel    string `json:"channel"`
+	Subscribed bool   `json:"subscribed"`
+}
+
+// NewChannelSubscribe returns a type:channel message that subscribes to the channel
+func NewChannelSubscribe(name string) Channel {
+	return Channel{Type: "channel", Channel: name, Subscribed: true}
+}
+
+// NewChannelUnsubscribe returns a type:channel message that unsubscribes from the channel
+func NewChannelUnsubscribe(name string) Channel {
+	return Channel{Type: "channel", Channel: name, Subscribed: false}
+}
+
+// UnmarshalJSON implements JSON deserialization of type:channel
+func (c *Channel) UnmarshalJSON(b []byte) error {
+	potential, err := unmarshalTypedMap(b, "channel")
+	if err != nil {
+		return err
+	}
+
+	newChan := Channel{Type: "channel"}
+
+	newChan.Channel, _ = potential["channel"].(string)
+	if _, err := NormalizeChannel(newChan.Channel); err != nil {
+		return ErrMalfromedMsg{"channel: invalid channel name", potential}
+	}
+
+	var ok bool
+	newChan.Subscribed, ok = potential["subscribed"].(bool)
+	if !ok {
+		return ErrMalfromedMsg{"channel: no boolean subscribed field", potential}
+	}
+
+	*c = newChan
+	return nil
+}
+
+// ChannelTracker keeps track of who is subscribed to which channel.
+// The message with the highest sequence of an author about a channel decides,
+// even if it reaches the tracker before older ones, for instance while a feed is replicated out of order.
+// It is safe for concurrent use.
+type ChannelTracker struct {
+	mu sync.RWMutex
+
+	// author -> normalized name -> subscribed
+	subs   map[FeedRef]map[string]bool
+	latest latestSequences
+}
+
+// NewChannelTracker returns an empty tracker
+func NewChannelTracker() *ChannelTracker {
+	return &ChannelTracker{
+		subs:   make(map[FeedRef]map[string]bool),
+		latest: make(latestSequences),
+	}
+}
+
+// Add ingests a channel message. It is ignored if the tracker already has a later message of the same author about the same channel.
+func (ct *ChannelTracker) Add(author FeedRef, seq int64, c Channel) error {
+	name, err := NormalizeChannel(c.Channel)
+	if err != nil {
+		return err
+	}
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if !ct.latest.advance(author, name, seq) {
+		return nil
+	}
+
+	byName, has := ct.subs[author]
+	if !has {
+		byName = make(map[string]bool)
+		ct.subs[author] = byName
+	}
+
+	byName[name] = c.Subscribed
+	return nil
+}
+
+// IsSubscribed returns true if the author is subscribed to the channel
+func (ct *ChannelTracker) IsSubscribed(author FeedRef, channel string) bool {
+	name, err := NormalizeChannel(channel)
+	if err != nil {
+		return false
+	}
+
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.subs[author][name]
+}
+
+// Subscriptions returns the normalized names of the channels the author is subscribed to, sorted
+func (ct *ChannelTracker) Subscriptions(author FeedRef) []string {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	var names []string
+	for name, subscribed := range ct.subs[author] {
+		if subscribed {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Subscribers is the other direction of Subscriptions: the authors that are subscribed to the channel, sorted by sigil
+func (ct *ChannelTracker) Subscribers(channel string) []FeedRef {
+	name, err := NormalizeChannel(channel)
+	if err != nil {
+		return nil
+	}
+
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	var feeds []FeedRef
+	for author, byName := range ct.subs {
+		if byName[name] {
+			feeds = append(feeds, author)
+		}
+	}
+
+	return sortFeeds(feeds)
+}
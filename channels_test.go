@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeChannel(t *testing.T) {
+	r := require.New(t)
+
+	tcs := []struct {
+		in, want string
+	}{
+		{"ssb", "ssb"},
+		{"#SSB", "ssb"},
+		{"hello world!", "helloworld"},
+		{`(a).b,c?<d>[e]"f"`, "abcdef"},
+		{"Über", "über"},
+		{"a\tb\nc", "abc"},
+		{"abcdefghijklmnopqrstuvwxyz012", "abcdefghijklmnopqrstuvwxyz012"},
+		{"#abcdefghijklmnopqrstuvwxyz012 ", "abcdefghijklmnopqrstuvwxyz012"},
+		{strings.Repeat("🐚", 14), strings.Repeat("🐚", 14)},
+	}
+	for _, tc := range tcs {
+		got, err := NormalizeChannel(tc.in)
+		r.NoError(err, tc.in)
+		r.Equal(tc.want, got, tc.in)
+	}
+
+	for _, in := range []string{
+		"", "#", " ?! ",
+		// too long for ssb-ref, instead of cutting them to the same name
+		"abcdefghijklmnopqrstuvwxyz0123",
+		"abcdefghijklmnopqrstuvwxyz0123456789",
+		// emoji are two UTF-16 code units each
+		strings.Repeat("🐚", 15),
+	} {
+		_, err := NormalizeChannel(in)
+		r.True(errors.Is(err, ErrInvalidChannel), in)
+	}
+
+	ref, err := NewChannelRef("#Go Lang")
+	r.NoError(err)
+	ch, ok := ref.IsChannel()
+	r.True(ok)
+	r.Equal("#golang", ch)
+}
+
+func TestChannelContent(t *testing.T) {
+	r := require.New(t)
+
+	var c Channel
+	r.NoError(json.Unmarshal([]byte(`{"type":"channel","channel":"ssb","subscribed":true}`), &c))
+	r.Equal(NewChannelSubscribe("ssb"), c)
+
+	r.NoError(json.Unmarshal([]byte(`{"type":"channel","channel":"ssb","subscribed":false}`), &c))
+	r.Equal(NewChannelUnsubscribe("ssb"), c)
+
+	for _, in := range []string{
+		`{"type":"channel","channel":"ssb"}`,
+		`{"type":"channel","channel":"ssb","subscribed":"yes"}`,
+		`{"type":"channel","channel":"#","subscribed":true}`,
+		`{"type":"channel","subscribed":true}`,
+	} {
+		err := json.Unmarshal([]byte(in), &c)
+		var malformed ErrMalfromedMsg
+		r.True(errors.As(err, &malformed), in)
+	}
+
+	err := json.Unmarshal([]byte(`{"type":"post","channel":"ssb","subscribed":true}`), &c)
+	r.True(errors.As(err, new(ErrWrongType)))
+
+	decoded, err := DecodeContent(Value{Content: []byte(`{"type":"channel","channel":"ssb","subscribed":true}`)})
+	r.NoError(err)
+	r.IsType(&Channel{}, decoded)
+
+	var p Post
+	r.NoError(json.Unmarshal([]byte(`{"type":"post","text":"hi","channel":"ssb"}`), &p))
+	r.Equal("ssb", p.Channel)
+}
+
+func TestChannelTracker(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		alice = newTestFeed('a')
+		bob   = newTestFeed('b')
+	)
+
+	ct := NewChannelTracker()
+	r.Empty(ct.Subscriptions(alice))
+
+	r.NoError(ct.Add(alice, 1, NewChannelSubscribe("ssb")))
+	r.NoError(ct.Add(alice, 2, NewChannelSubscribe("#GoLang")))
+	r.NoError(ct.Add(bob, 5, NewChannelSubscribe("golang")))
+
+	r.Equal([]string{"golang", "ssb"}, ct.Subscriptions(alice))
+	r.True(ct.IsSubscribed(alice, "#golang"))
+	r.Equal(sortedBySigil(alice, bob), ct.Subscribers("golang"))
+
+	r.NoError(ct.Add(alice, 3, NewChannelUnsubscribe("golang")))
+	r.Equal([]string{"ssb"}, ct.Subscriptions(alice))
+	r.Equal([]FeedRef{bob}, ct.Subscribers("golang"))
+
+	// an older message arriving late doesn't change anything
+	r.NoError(ct.Add(alice, 2, NewChannelSubscribe("golang")))
+	r.False(ct.IsSubscribed(alice, "golang"))
+
+	// the unsubscribe arrives before the subscribe
+	r.NoError(ct.Add(bob, 7, NewChannelUnsubscribe("ssb")))
+	r.NoError(ct.Add(bob, 6, NewChannelSubscribe("ssb")))
+	r.False(ct.IsSubscribed(bob, "ssb"))
+
+	err := ct.Add(bob, 8, NewChannelSubscribe("?"))
+	r.True(errors.Is(err, ErrInvalidChannel))
+	r.Nil(ct.Subscribers("#"))
+}
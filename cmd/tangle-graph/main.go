@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+// tangle-graph reads messages as JSON lines ({key, value, timestamp} objects) and prints the tangle they form,
+// either in the DOT language of graphviz or as JSON.
+//
+//	tangle-graph -tangle post -format dot < thread.jsonl | dot -Tsvg > thread.svg
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+func main() {
+	var (
+		tangleName = flag.String("tangle", refs.ThreadTangleName, "name of the tangle to follow")
+		format     = flag.String("format", "dot", "output format (dot or json)")
+	)
+	flag.Parse()
+
+	var input io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		check(err)
+		defer f.Close()
+		input = f
+	}
+
+	var items []refs.TangledPost
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 8*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var msg refs.KeyValueRaw
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("line %d: skipping invalid message: %s", line, err)
+			continue
+		}
+
+		var post refs.Post
+		if err := json.Unmarshal(msg.Value.Content, &post); err != nil {
+			log.Printf("line %d: skipping unusable content of %s: %s", line, msg.Key().ShortSigil(), err)
+			continue
+		}
+
+		items = append(items, refs.NewThreadPost(msg.Key(), post))
+	}
+	check(scanner.Err())
+
+	sorter := refs.ByPrevious{TangleName: *tangleName, Items: items}
+	graph := sorter.Graph()
+
+	switch *format {
+	case "dot":
+		check(graph.WriteDOT(os.Stdout))
+	case "json":
+		check(graph.WriteJSON(os.Stdout))
+	default:
+		check(fmt.Errorf("unknown format: %q", *format))
+	}
+}
+
+func check(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Link is a reference somewhere inside the content of a message.
+type Link struct {
+	// Path is the JSON pointer (RFC 6901) to the string value of the reference, like /mentions/0/link
+	Path string
+
+	// Rel is the name of the field that holds the reference.
+	// For {link: ...} objects and arrays it is the name of the field that holds those.
+	Rel string
+
+	Ref AnyRef
+}
+
+// Links walks the whole content of a message and returns every string value that parses as a reference,
+// like ssb-links does. Object keys are visited in sorted order, so the result is stable.
+// Encrypted content (a plain string) has no links.
+func Links(content json.RawMessage) ([]Link, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("ssb/links: invalid content: %w", err)
+	}
+
+	var links []Link
+	collectLinks(&links, v, "", "")
+	return links, nil
+}
+
+func collectLinks(links *[]Link, v interface{}, path, rel string) {
+	switch tv := v.(type) {
+	case string:
+		if path == "" {
+			return
+		}
+		r, err := ParseRef(tv)
+		if err != nil {
+			return
+		}
+		*links = append(*links, Link{Path: path, Rel: rel, Ref: AnyRef{r: r}})
+
+	case []interface{}:
+		for i, elem := range tv {
+			collectLinks(links, elem, path+"/"+strconv.Itoa(i), rel)
+		}
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(tv))
+		for k := range tv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			childRel := k
+			if k == "link" {
+				childRel = rel
+			}
+			collectLinks(links, tv[k], path+"/"+escapeJSONPointer(k), childRel)
+		}
+	}
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapeJSONPointer(key string) string {
+	return jsonPointerEscaper.Replace(key)
+}
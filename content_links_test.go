@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinks(t *testing.T) {
+	r := require.New(t)
+
+	const (
+		feed = "@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519"
+		msg  = "%g3hPVPDEO1Aj/uPl0+J2NlhFB2bbFLIHlty+YuqFZ3w=.sha256"
+		blob = "&sbBmsB7XWvmIzkBzreYcuzPpLtpeCMDIs6n/OJGSC1U=.sha256"
+		uri  = "ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w="
+	)
+
+	content := `{
+		"type": "post",
+		"text": "hello ` + feed + `",
+		"root": "` + msg + `",
+		"branch": ["` + msg + `", "not a ref"],
+		"mentions": [
+			{"link": "` + feed + `", "name": "alice"},
+			{"link": "#channel"}
+		],
+		"about": {"image": {"link": "` + blob + `", "size": 23}},
+		"weird/key~": "` + uri + `",
+		"count": 42
+	}`
+
+	links, err := Links(json.RawMessage(content))
+	r.NoError(err)
+
+	type expect struct{ path, rel, sigil string }
+	var want = []expect{
+		{"/about/image/link", "image", blob},
+		{"/branch/0", "branch", msg},
+		{"/mentions/0/link", "mentions", feed},
+		{"/root", "root", msg},
+		{"/weird~1key~0", "weird/key~", msg},
+	}
+
+	r.Len(links, len(want))
+	for i, w := range want {
+		r.Equal(w.path, links[i].Path, "link %d", i)
+		r.Equal(w.rel, links[i].Rel, "link %d", i)
+		r.Equal(w.sigil, links[i].Ref.Sigil(), "link %d", i)
+	}
+
+	// private messages have no links
+	links, err = Links(json.RawMessage(`"Zm9vYmFy.box"`))
+	r.NoError(err)
+	r.Empty(links)
+
+	_, err = Links(json.RawMessage(`{"type":`))
+	r.Error(err)
+}
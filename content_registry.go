@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrContentTypeRegistered is returned if a content type is registered twice on the same registry
+var ErrContentTypeRegistered = errors.New("ssb: content type already registered")
+
+// ContentFactory returns a pointer to a new, empty value of a content type.
+// The content is unmarshaled into it.
+type ContentFactory func() interface{}
+
+// PrivateContent is returned by DecodeContent for encrypted content, which is just a string like "base64.box"
+type PrivateContent struct {
+	Box string
+}
+
+// UnknownContent is returned by DecodeContent for content types that are not registered
+type UnknownContent map[string]interface{}
+
+// Type returns the type field of the content
+func (uc UnknownContent) Type() string {
+	t, _ := uc["type"].(string)
+	return t
+}
+
+// ContentRegistry maps the type field of content to the go type it is decoded into.
+// It is safe for concurrent use.
+type ContentRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]ContentFactory
+}
+
+// NewContentRegistry returns an empty registry
+func NewContentRegistry() *ContentRegistry {
+	return &ContentRegistry{factories: make(map[string]ContentFactory)}
+}
+
+// NewDefaultContentRegistry returns a registry with all the content types of this package registered
+func NewDefaultContentRegistry() *ContentRegistry {
+	cr := NewContentRegistry()
+	for typ, f := range builtinContentTypes {
+		cr.factories[typ] = f
+	}
+	return cr
+}
+
+var builtinContentTypes = map[string]ContentFactory{
+	"post":       func() interface{} { return new(Post) },
+	"contact":    func() interface{} { return new(Contact) },
+	"about":      func() interface{} { return new(About) },
+	"vote":       func() interface{} { return new(Vote) },
+	"pub":        func() interface{} { return new(PubMessage) },
+	"address":    func() interface{} { return new(AddressMessage) },
+	"room/alias": func() interface{} { return new(RoomAliasMessage) },
+	"channel":    func() interface{} { return new(Channel) },
+
+	"group/init":           func() interface{} { return new(GroupInit) },
+	"group/add-member":     func() interface{} { return new(GroupAddMember) },
+	"group/exclude-member": func() interface{} { return new(GroupExcludeMember) },
+}
+
+// Register adds a content type to the registry. The factory needs to return a pointer.
+func (cr *ContentRegistry) Register(typ string, f ContentFactory) error {
+	if typ == "" || f == nil {
+		return fmt.Errorf("ssb/content: need a type and a factory")
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if _, has := cr.factories[typ]; has {
+		return fmt.Errorf("%w: %q", ErrContentTypeRegistered, typ)
+	}
+	cr.factories[typ] = f
+	return nil
+}
+
+// Decode returns the typed content for registered types,
+// PrivateContent for encrypted content and UnknownContent for everything else.
+func (cr *ContentRegistry) Decode(content json.RawMessage) (interface{}, error) {
+	var box string
+	if err := json.Unmarshal(content, &box); err == nil {
+		return PrivateContent{Box: box}, nil
+	}
+
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(content, &typed); err != nil {
+		return nil, fmt.Errorf("ssb/content: not an object: %w", err)
+	}
+	if typed.Type == "" {
+		return nil, ErrMalfromedMsg{"ssb/content: no type on content", nil}
+	}
+
+	cr.mu.RLock()
+	f, has := cr.factories[typed.Type]
+	cr.mu.RUnlock()
+
+	if !has {
+		var unknown UnknownContent
+		if err := json.Unmarshal(content, &unknown); err != nil {
+			return nil, fmt.Errorf("ssb/content: %s: %w", typed.Type, err)
+		}
+		return unknown, nil
+	}
+
+	v := f()
+	if err := json.Unmarshal(content, v); err != nil {
+		return nil, fmt.Errorf("ssb/content: failed to decode %s: %w", typed.Type, err)
+	}
+	return v, nil
+}
+
+var defaultContentRegistry = NewDefaultContentRegistry()
+
+// RegisterContentType adds a content type to the registry that DecodeContent uses.
+func RegisterContentType(typ string, f ContentFactory) error {
+	return defaultContentRegistry.Register(typ, f)
+}
+
+// DecodeContent decodes the content of the message into the type that is registered for it.
+// See (*ContentRegistry).Decode for the details.
+func DecodeContent(v Value) (interface{}, error) {
+	return defaultContentRegistry.Decode(v.Content)
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeContent(t *testing.T) {
+	r := require.New(t)
+
+	const feed = "@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519"
+
+	var v Value
+
+	v.Content = json.RawMessage(`{"type":"post","text":"hello"}`)
+	c, err := DecodeContent(v)
+	r.NoError(err)
+	post, ok := c.(*Post)
+	r.True(ok, "wrong type %T", c)
+	r.Equal("hello", post.Text)
+
+	v.Content = json.RawMessage(`{"type":"contact","contact":"` + feed + `","following":true}`)
+	c, err = DecodeContent(v)
+	r.NoError(err)
+	contact, ok := c.(*Contact)
+	r.True(ok, "wrong type %T", c)
+	r.True(contact.Following)
+
+	v.Content = json.RawMessage(`{"type":"about","about":"` + feed + `","name":"alice"}`)
+	c, err = DecodeContent(v)
+	r.NoError(err)
+	r.IsType(&About{}, c)
+
+	v.Content = json.RawMessage(`"c2VjcmV0.box"`)
+	c, err = DecodeContent(v)
+	r.NoError(err)
+	r.Equal(PrivateContent{Box: "c2VjcmV0.box"}, c)
+
+	v.Content = json.RawMessage(`{"type":"gathering","progenitor":null}`)
+	c, err = DecodeContent(v)
+	r.NoError(err)
+	unknown, ok := c.(UnknownContent)
+	r.True(ok, "wrong type %T", c)
+	r.Equal("gathering", unknown.Type())
+	r.Contains(unknown, "progenitor")
+
+	// registered but invalid
+	v.Content = json.RawMessage(`{"type":"about","name":"who?"}`)
+	_, err = DecodeContent(v)
+	r.True(IsMessageUnusable(err))
+
+	v.Content = json.RawMessage(`{"text":"no type"}`)
+	_, err = DecodeContent(v)
+	r.True(IsMessageUnusable(err))
+
+	v.Content = json.RawMessage(`[1,2,3]`)
+	_, err = DecodeContent(v)
+	r.Error(err)
+}
+
+type testGathering struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+func TestContentRegistry(t *testing.T) {
+	r := require.New(t)
+
+	cr := NewContentRegistry()
+	r.NoError(cr.Register("gathering", func() interface{} { return new(testGathering) }))
+
+	err := cr.Register("gathering", func() interface{} { return new(testGathering) })
+	r.True(errors.Is(err, ErrContentTypeRegistered))
+
+	c, err := cr.Decode(json.RawMessage(`{"type":"gathering","title":"party"}`))
+	r.NoError(err)
+	r.Equal(&testGathering{Type: "gathering", Title: "party"}, c)
+
+	// empty registries know nothing
+	c, err = cr.Decode(json.RawMessage(`{"type":"post","text":"hi"}`))
+	r.NoError(err)
+	r.IsType(UnknownContent{}, c)
+
+	// default types can't be replaced
+	def := NewDefaultContentRegistry()
+	err = def.Register("post", func() interface{} { return new(testGathering) })
+	r.True(errors.Is(err, ErrContentTypeRegistered))
+}
@@ -18,6 +18,8 @@ var (
 	ErrInvalidSig        = errors.New("ssb: Invalid Signature")
 	ErrInvalidHash       = errors.New("ssb: Invalid Hash")
 	ErrUnuspportedFormat = errors.New("ssb: unsupported format")
+
+	ErrInvalidTanglePoint = errors.New("ssb: invalid tangle point")
 )
 
 // ErrRefLen is returned when a parsed reference was too short.
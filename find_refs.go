@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FoundRef is a reference that FindRefs found in a text.
+type FoundRef struct {
+	Ref AnyRef
+
+	// Start and End are the byte offsets of the reference in the text, so that text[Start:End] is the reference as written.
+	Start, End int
+
+	// Name is the text of the markdown link around the reference, if there was one.
+	Name string
+}
+
+// Mention returns the found reference as a mention, like it is used in posts.
+func (fr FoundRef) Mention() Mention {
+	return Mention{Link: fr.Ref, Name: fr.Name}
+}
+
+var (
+	findSigilRegexp        = regexp.MustCompile(`[@%&][A-Za-z0-9+/]{43}=\.[a-z0-9]+(?:-v[0-9]+)?`)
+	findURIRegexp          = regexp.MustCompile(`ssb:(?:message|feed|blob)/[a-z0-9-]+/[A-Za-z0-9_\-+=%]+`)
+	findChannelRegexp      = regexp.MustCompile(`#[^\s,.?!<>()\[\]"#]+`)
+	findMarkdownLinkRegexp = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]+)\)`)
+)
+
+// FindRefs scans free text or markdown for references and returns them in the order they appear.
+// It finds sigils (@feed, %message and &blob), canonical ssb: URIs, #channel hashtags and the targets of markdown links,
+// which might be percent-escaped (%25 for the message sigil).
+// Invalid references are skipped.
+func FindRefs(text string) []FoundRef {
+	var (
+		found   []FoundRef
+		covered [][2]int
+	)
+
+	isCovered := func(start, end int) bool {
+		for _, c := range covered {
+			if start < c[1] && end > c[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	// markdown links first, so that their name is kept and the target is not found twice
+	for _, m := range findMarkdownLinkRegexp.FindAllStringSubmatchIndex(text, -1) {
+		name, start, end := text[m[2]:m[3]], m[4], m[5]
+
+		ref, ok := parseFoundRef(text[start:end], true)
+		if !ok {
+			continue
+		}
+
+		if _, isFeed := ref.IsFeed(); isFeed {
+			name = strings.TrimPrefix(name, "@")
+		}
+
+		found = append(found, FoundRef{Ref: ref, Start: start, End: end, Name: name})
+		covered = append(covered, [2]int{start, end})
+	}
+
+	for _, re := range []*regexp.Regexp{findSigilRegexp, findURIRegexp} {
+		for _, m := range re.FindAllStringIndex(text, -1) {
+			if isCovered(m[0], m[1]) {
+				continue
+			}
+
+			ref, ok := parseFoundRef(text[m[0]:m[1]], false)
+			if !ok {
+				continue
+			}
+
+			found = append(found, FoundRef{Ref: ref, Start: m[0], End: m[1]})
+			covered = append(covered, [2]int{m[0], m[1]})
+		}
+	}
+
+	for _, m := range findChannelRegexp.FindAllStringIndex(text, -1) {
+		// only at the start of a word, not C# or page#section
+		if m[0] > 0 && !strings.ContainsAny(text[m[0]-1:m[0]], " \t\r\n([{>") {
+			continue
+		}
+		if isCovered(m[0], m[1]) {
+			continue
+		}
+
+		found = append(found, FoundRef{Ref: AnyRef{channel: text[m[0]:m[1]]}, Start: m[0], End: m[1]})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Start < found[j].Start
+	})
+
+	return found
+}
+
+// parseFoundRef parses sigils and canonical URIs. Link targets might also be percent-escaped.
+func parseFoundRef(s string, escaped bool) (AnyRef, bool) {
+	if escaped {
+		if unescaped, err := url.PathUnescape(s); err == nil {
+			s = unescaped
+		}
+	}
+
+	if strings.HasPrefix(s, "ssb:") {
+		u, _, err := ParseURILenient(s)
+		if err != nil {
+			return AnyRef{}, false
+		}
+		c, ok := u.(CanonicalURI)
+		if !ok {
+			return AnyRef{}, false
+		}
+		return AnyRef{r: c.ref}, true
+	}
+
+	if strings.HasPrefix(s, "#") && len(s) > 1 && escaped {
+		return AnyRef{channel: s}, true
+	}
+
+	r, err := ParseRef(s)
+	if err != nil {
+		return AnyRef{}, false
+	}
+	return AnyRef{r: r}, true
+}
+
+// MentionsFromText returns the mentions for all the references in text.
+// Every reference is only mentioned once, with the first name it was linked with.
+func MentionsFromText(text string) []Mention {
+	var (
+		mentions []Mention
+		seen     = make(map[string]int)
+	)
+
+	for _, fr := range FindRefs(text) {
+		key, ok := fr.Ref.IsChannel()
+		if !ok {
+			key = fr.Ref.Sigil()
+		}
+
+		if idx, has := seen[key]; has {
+			if mentions[idx].Name == "" {
+				mentions[idx].Name = fr.Name
+			}
+			continue
+		}
+
+		seen[key] = len(mentions)
+		mentions = append(mentions, fr.Mention())
+	}
+
+	return mentions
+}
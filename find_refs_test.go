@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindRefs(t *testing.T) {
+	r := require.New(t)
+
+	const (
+		feed = "@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519"
+		msg  = "%g3hPVPDEO1Aj/uPl0+J2NlhFB2bbFLIHlty+YuqFZ3w=.sha256"
+		blob = "&sbBmsB7XWvmIzkBzreYcuzPpLtpeCMDIs6n/OJGSC1U=.sha256"
+		uri  = "ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w="
+	)
+
+	text := "hey [@alice](" + feed + "), did you see " + msg + "?\n" +
+		"![cat picture](" + blob + ") #cats #go-lang\n" +
+		"also " + uri + ". Not C#, page#section or " + "@tooshort=.ed25519\n" +
+		"[escaped](%25g3hPVPDEO1Aj%2FuPl0%2BJ2NlhFB2bbFLIHlty%2BYuqFZ3w%3D.sha256) [web](https://example.com)"
+
+	found := FindRefs(text)
+	r.Len(found, 7)
+
+	type expect struct {
+		sigil string
+		span  string
+		name  string
+	}
+	var want = []expect{
+		{feed, feed, "alice"},
+		{msg, msg, ""},
+		{blob, blob, "cat picture"},
+		{"#cats", "#cats", ""},
+		{"#go-lang", "#go-lang", ""},
+		{msg, uri, ""},
+		{msg, "%25g3hPVPDEO1Aj%2FuPl0%2BJ2NlhFB2bbFLIHlty%2BYuqFZ3w%3D.sha256", "escaped"},
+	}
+
+	for i, w := range want {
+		fr := found[i]
+		if ch, ok := fr.Ref.IsChannel(); ok {
+			r.Equal(w.sigil, ch, "ref %d", i)
+		} else {
+			r.Equal(w.sigil, fr.Ref.Sigil(), "ref %d", i)
+		}
+		r.Equal(w.span, text[fr.Start:fr.End], "ref %d", i)
+		r.Equal(w.name, fr.Name, "ref %d", i)
+	}
+
+	mentions := MentionsFromText(text)
+	r.Len(mentions, 5)
+	r.Equal("escaped", mentions[1].Name, "name of a later link should fill in")
+
+	out, err := json.Marshal(mentions)
+	r.NoError(err)
+	r.Equal(`[{"link":"`+feed+`","name":"alice"},{"link":"`+msg+`","name":"escaped"},{"link":"\u0026`+blob[1:]+`","name":"cat picture"},{"link":"#cats"},{"link":"#go-lang"}]`, string(out))
+
+	r.Empty(FindRefs("nothing to see here, mail me@example.com"))
+}
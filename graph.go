@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrContactOutOfOrder is returned by (*Graph).Add if a contact message of an author is not newer than the last one
+var ErrContactOutOfOrder = errors.New("ssb/graph: contact message out of order")
+
+// ContactState is the relation of one feed to another, as set by its latest contact message about it.
+type ContactState int
+
+// The possible states of a relation
+const (
+	ContactNone ContactState = iota
+	ContactFollowing
+	ContactBlocking
+)
+
+// StateOf returns the relation a contact message sets. Blocking wins over following.
+func (c Contact) StateOf() ContactState {
+	switch {
+	case c.Blocking:
+		return ContactBlocking
+	case c.Following:
+		return ContactFollowing
+	default:
+		return ContactNone
+	}
+}
+
+// Graph is the social graph that results from the contact messages of all feeds, like ssb-friends computes it.
+// Only the latest contact message of an author about a feed counts.
+// It is safe for concurrent use.
+type Graph struct {
+	mu sync.RWMutex
+
+	edges   map[FeedRef]map[FeedRef]ContactState
+	lastSeq map[FeedRef]int64
+}
+
+// NewGraph returns an empty graph
+func NewGraph() *Graph {
+	return &Graph{
+		edges:   make(map[FeedRef]map[FeedRef]ContactState),
+		lastSeq: make(map[FeedRef]int64),
+	}
+}
+
+// Add ingests a contact message. The messages of each author need to be added in sequence order,
+// otherwise ErrContactOutOfOrder is returned and the message is ignored.
+func (g *Graph) Add(author FeedRef, seq int64, c Contact) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if last, has := g.lastSeq[author]; has && seq <= last {
+		return fmt.Errorf("%w: %s has %d, got %d", ErrContactOutOfOrder, author.ShortSigil(), last, seq)
+	}
+	g.lastSeq[author] = seq
+
+	out, has := g.edges[author]
+	if !has {
+		out = make(map[FeedRef]ContactState)
+		g.edges[author] = out
+	}
+
+	state := c.StateOf()
+	if state == ContactNone {
+		delete(out, c.Contact)
+	} else {
+		out[c.Contact] = state
+	}
+	return nil
+}
+
+// State returns the relation from a to b
+func (g *Graph) State(a, b FeedRef) ContactState {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.edges[a][b]
+}
+
+// Follows returns true if a follows b
+func (g *Graph) Follows(a, b FeedRef) bool {
+	return g.State(a, b) == ContactFollowing
+}
+
+// Blocks returns true if a blocks b
+func (g *Graph) Blocks(a, b FeedRef) bool {
+	return g.State(a, b) == ContactBlocking
+}
+
+// Hops returns the distance of the feeds in the follow graph of root, up to maxHops.
+// root itself has distance 0. Feeds that root blocks have distance -1 and are not followed any further,
+// no matter how close they are through others.
+func (g *Graph) Hops(root FeedRef, maxHops int) map[FeedRef]int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	hops := map[FeedRef]int{root: 0}
+	for feed, state := range g.edges[root] {
+		if state == ContactBlocking && feed != root {
+			hops[feed] = -1
+		}
+	}
+
+	current := []FeedRef{root}
+	for dist := 1; dist <= maxHops && len(current) > 0; dist++ {
+		var next []FeedRef
+		for _, feed := range current {
+			for followed, state := range g.edges[feed] {
+				if state != ContactFollowing {
+					continue
+				}
+				if _, seen := hops[followed]; seen {
+					continue
+				}
+				hops[followed] = dist
+				next = append(next, followed)
+			}
+		}
+		current = next
+	}
+
+	return hops
+}
+
+// Replicate returns the feeds that root should replicate: all feeds within maxHops that it doesn't block, including itself.
+// They are sorted by their sigil.
+func (g *Graph) Replicate(root FeedRef, maxHops int) []FeedRef {
+	var feeds []FeedRef
+	for feed, dist := range g.Hops(root, maxHops) {
+		if dist >= 0 {
+			feeds = append(feeds, feed)
+		}
+	}
+
+	return sortFeeds(feeds)
+}
+
+// Blocked returns the feeds that root blocks directly, sorted by their sigil.
+func (g *Graph) Blocked(root FeedRef) []FeedRef {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var feeds []FeedRef
+	for feed, state := range g.edges[root] {
+		if state == ContactBlocking {
+			feeds = append(feeds, feed)
+		}
+	}
+
+	return sortFeeds(feeds)
+}
+
+// sortFeeds sorts feeds by their sigil, the order in which the graph and the other indexes of this package return feeds
+func sortFeeds(feeds []FeedRef) []FeedRef {
+	sort.Slice(feeds, func(i, j int) bool {
+		return feedLess(feeds[i], feeds[j])
+	})
+	return feeds
+}
+
+func feedLess(a, b FeedRef) bool {
+	return a.Sigil() < b.Sigil()
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFeed(b byte) FeedRef {
+	var fr FeedRef
+	fr.algo = RefAlgoFeedSSB1
+	copy(fr.id[:], bytes.Repeat([]byte{b}, 32))
+	return fr
+}
+
+func TestGraph(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		alice  = newTestFeed('a')
+		bob    = newTestFeed('b')
+		claire = newTestFeed('c')
+		dave   = newTestFeed('d')
+		eve    = newTestFeed('e')
+		frank  = newTestFeed('f')
+	)
+
+	g := NewGraph()
+
+	// alice -> bob -> claire -> dave
+	r.NoError(g.Add(alice, 1, NewContactFollow(bob)))
+	r.NoError(g.Add(bob, 1, NewContactFollow(claire)))
+	r.NoError(g.Add(claire, 1, NewContactFollow(dave)))
+
+	// bob follows eve, but alice blocks her
+	r.NoError(g.Add(bob, 2, NewContactFollow(eve)))
+	r.NoError(g.Add(alice, 2, NewContactBlock(eve)))
+
+	// eve's follows don't count for alice
+	r.NoError(g.Add(eve, 1, NewContactFollow(frank)))
+
+	// claire blocks bob, that doesn't matter to alice
+	r.NoError(g.Add(claire, 2, NewContactBlock(bob)))
+
+	r.True(g.Follows(alice, bob))
+	r.True(g.Blocks(alice, eve))
+	r.True(g.Blocks(claire, bob))
+	r.False(g.Follows(claire, bob))
+	r.Equal(ContactNone, g.State(dave, alice))
+
+	r.Equal(map[FeedRef]int{alice: 0, bob: 1, claire: 2, eve: -1}, g.Hops(alice, 2))
+	r.Equal(map[FeedRef]int{alice: 0, bob: 1, claire: 2, dave: 3, eve: -1}, g.Hops(alice, 3))
+	r.Equal(map[FeedRef]int{alice: 0, eve: -1}, g.Hops(alice, 0))
+
+	r.Equal(sortedBySigil(alice, bob, claire, dave), g.Replicate(alice, 3))
+	r.Equal([]FeedRef{eve}, g.Blocked(alice))
+
+	// from bob's point of view
+	r.Equal(map[FeedRef]int{bob: 0, claire: 1, eve: 1, dave: 2, frank: 2}, g.Hops(bob, 2))
+
+	// unfollow and unblock
+	r.NoError(g.Add(alice, 3, Contact{Type: "contact", Contact: bob}))
+	r.NoError(g.Add(alice, 4, Contact{Type: "contact", Contact: eve}))
+	r.Equal(map[FeedRef]int{alice: 0}, g.Hops(alice, 3))
+	r.Empty(g.Blocked(alice))
+
+	// the latest message wins, older ones are rejected
+	err := g.Add(alice, 4, NewContactFollow(bob))
+	r.True(errors.Is(err, ErrContactOutOfOrder))
+	err = g.Add(alice, 2, NewContactFollow(bob))
+	r.True(errors.Is(err, ErrContactOutOfOrder))
+	r.False(g.Follows(alice, bob))
+
+	// unfollowing is not blocking, bob is still reached through someone else
+	r.NoError(g.Add(alice, 5, NewContactFollow(claire)))
+	r.NoError(g.Add(claire, 3, NewContactFollow(bob)))
+	r.Equal(map[FeedRef]int{alice: 0, claire: 1, dave: 2, bob: 2}, g.Hops(alice, 2))
+
+	// blocking wins over a later follow through someone else
+	r.NoError(g.Add(alice, 6, NewContactBlock(bob)))
+	r.NoError(g.Add(dave, 1, NewContactFollow(bob)))
+	r.Equal(map[FeedRef]int{alice: 0, claire: 1, dave: 2, bob: -1}, g.Hops(alice, 2))
+	r.Equal([]FeedRef{bob}, g.Blocked(alice))
+
+	// but not over a later direct follow, which replaces the block
+	r.NoError(g.Add(alice, 7, NewContactFollow(bob)))
+	r.Equal(map[FeedRef]int{alice: 0, claire: 1, dave: 2, bob: 1, eve: 2}, g.Hops(alice, 2))
+	r.Empty(g.Blocked(alice))
+}
+
+func sortedBySigil(feeds ...FeedRef) []FeedRef {
+	return sortFeeds(feeds)
+}
+
+func TestSortFeeds(t *testing.T) {
+	feeds := sortFeeds([]FeedRef{newTestFeed('a'), newTestFeed('b'), newTestFeed('c')})
+
+	// by sigil, not by the bytes of the key: "@Y2Nj..." < "@YWFh..." < "@YmJi..."
+	require.Equal(t, []FeedRef{newTestFeed('c'), newTestFeed('a'), newTestFeed('b')}, feeds)
+}
@@ -0,0 +1,264 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The names of the tangles that private group messages use
+const (
+	GroupTangleName   = "group"
+	MembersTangleName = "members"
+)
+
+// MaxGroupAddMembers is the most feeds a group/add-member message can add, the group itself takes one of the 16 slots of box2
+const MaxGroupAddMembers = 15
+
+// GroupInit starts a private group (type:group/init).
+// It is boxed with the new group key and is the root of the group tangle.
+type GroupInit struct {
+	Type    string  `json:"type"`
+	Name    string  `json:"name,omitempty"`
+	Tangles Tangles `json:"tangles"`
+}
+
+// NewGroupInit returns a group/init message, which starts the group tangle
+func NewGroupInit(name string) GroupInit {
+	return GroupInit{
+		Type:    "group/init",
+		Name:    name,
+		Tangles: Tangles{GroupTangleName: TanglePoint{}},
+	}
+}
+
+// UnmarshalJSON implements JSON deserialization of type:group/init
+func (gi *GroupInit) UnmarshalJSON(b []byte) error {
+	potential, err := unmarshalTypedMap(b, "group/init")
+	if err != nil {
+		return err
+	}
+
+	type plain GroupInit
+	var newInit plain
+	if err := json.Unmarshal(b, &newInit); err != nil {
+		return fmt.Errorf("group/init: %w", err)
+	}
+
+	tp, has := newInit.Tangles[GroupTangleName]
+	if !has || tp.Root != nil {
+		return ErrMalfromedMsg{"group/init: needs to be the root of the group tangle", potential}
+	}
+
+	*gi = GroupInit(newInit)
+	return nil
+}
+
+// GroupAddMember gives new members the key of a group (type:group/add-member).
+// The first recipient is the cloaked group ID, the others are the feeds that are added.
+type GroupAddMember struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+
+	// GroupKey is the symmetric key of the group, encoded as base64
+	GroupKey []byte `json:"groupKey"`
+
+	// Root is the group/init message
+	Root MessageRef `json:"root"`
+
+	Text string `json:"text,omitempty"`
+
+	Recps   []AnyRef `json:"recps"`
+	Tangles Tangles  `json:"tangles"`
+}
+
+// NewGroupAddMember returns a group/add-member message for the passed members.
+// The previous of the group and members tangles point to the root and need to be updated with the current tips of those tangles.
+func NewGroupAddMember(groupID MessageRef, groupKey []byte, root MessageRef, members ...FeedRef) GroupAddMember {
+	recps := []AnyRef{{r: groupID}}
+	for _, m := range members {
+		recps = append(recps, AnyRef{r: m})
+	}
+
+	return GroupAddMember{
+		Type:     "group/add-member",
+		Version:  "v1",
+		GroupKey: groupKey,
+		Root:     root,
+		Recps:    recps,
+		Tangles: Tangles{
+			GroupTangleName:   TanglePoint{Root: &root, Previous: MessageRefs{root}},
+			MembersTangleName: TanglePoint{Root: &root, Previous: MessageRefs{root}},
+		},
+	}
+}
+
+// GroupID returns the cloaked ID of the group, the first recipient.
+// It returns false if the message has no recipients or the first one is not a message.
+func (ga GroupAddMember) GroupID() (MessageRef, bool) {
+	return groupIDFromRecps(ga.Recps)
+}
+
+// Members returns the feeds that are added to the group, the recipients after the group ID.
+// It returns false if there are none or one of them is not a feed.
+func (ga GroupAddMember) Members() ([]FeedRef, bool) {
+	if len(ga.Recps) < 2 {
+		return nil, false
+	}
+
+	feeds := make([]FeedRef, len(ga.Recps)-1)
+	for i, r := range ga.Recps[1:] {
+		fr, ok := r.IsFeed()
+		if !ok {
+			return nil, false
+		}
+		feeds[i] = fr
+	}
+	return feeds, true
+}
+
+// UnmarshalJSON implements JSON deserialization of type:group/add-member
+func (ga *GroupAddMember) UnmarshalJSON(b []byte) error {
+	potential, err := unmarshalTypedMap(b, "group/add-member")
+	if err != nil {
+		return err
+	}
+
+	type plain GroupAddMember
+	var newAdd plain
+	if err := json.Unmarshal(b, &newAdd); err != nil {
+		return fmt.Errorf("group/add-member: %w", err)
+	}
+
+	if newAdd.Version != "v1" {
+		return ErrMalfromedMsg{"group/add-member: unsupported version", potential}
+	}
+
+	if n := len(newAdd.GroupKey); n != 32 {
+		return ErrMalfromedMsg{fmt.Sprintf("group/add-member: group key has wrong length %d", n), potential}
+	}
+
+	if err := checkGroupRecps(newAdd.Recps, MaxGroupAddMembers); err != nil {
+		return ErrMalfromedMsg{"group/add-member: " + err.Error(), potential}
+	}
+	if len(newAdd.Recps) < 2 {
+		return ErrMalfromedMsg{"group/add-member: no members to add", potential}
+	}
+
+	if err := checkGroupTangles(newAdd.Tangles, newAdd.Root); err != nil {
+		return ErrMalfromedMsg{"group/add-member: " + err.Error(), potential}
+	}
+
+	*ga = GroupAddMember(newAdd)
+	return nil
+}
+
+// GroupExcludeMember removes members from a group (type:group/exclude-member).
+// It is only sent to the group, the excluded members need to be left out of the next group key.
+type GroupExcludeMember struct {
+	Type     string    `json:"type"`
+	Excludes []FeedRef `json:"excludes"`
+
+	Recps   []AnyRef `json:"recps"`
+	Tangles Tangles  `json:"tangles"`
+}
+
+// NewGroupExcludeMember returns a group/exclude-member message for the passed members.
+// Like with NewGroupAddMember, previous of the tangles need to be updated with the current tips.
+func NewGroupExcludeMember(groupID MessageRef, root MessageRef, excludes ...FeedRef) GroupExcludeMember {
+	return GroupExcludeMember{
+		Type:     "group/exclude-member",
+		Excludes: excludes,
+		Recps:    []AnyRef{{r: groupID}},
+		Tangles: Tangles{
+			GroupTangleName:   TanglePoint{Root: &root, Previous: MessageRefs{root}},
+			MembersTangleName: TanglePoint{Root: &root, Previous: MessageRefs{root}},
+		},
+	}
+}
+
+// GroupID returns the cloaked ID of the group, the only recipient.
+// It returns false if the message has no recipients or the first one is not a message.
+func (ge GroupExcludeMember) GroupID() (MessageRef, bool) {
+	return groupIDFromRecps(ge.Recps)
+}
+
+// UnmarshalJSON implements JSON deserialization of type:group/exclude-member
+func (ge *GroupExcludeMember) UnmarshalJSON(b []byte) error {
+	potential, err := unmarshalTypedMap(b, "group/exclude-member")
+	if err != nil {
+		return err
+	}
+
+	type plain GroupExcludeMember
+	var newExclude plain
+	if err := json.Unmarshal(b, &newExclude); err != nil {
+		return fmt.Errorf("group/exclude-member: %w", err)
+	}
+
+	if len(newExclude.Excludes) == 0 {
+		return ErrMalfromedMsg{"group/exclude-member: nobody to exclude", potential}
+	}
+
+	if err := checkGroupRecps(newExclude.Recps, 0); err != nil {
+		return ErrMalfromedMsg{"group/exclude-member: " + err.Error(), potential}
+	}
+
+	tp, has := newExclude.Tangles[GroupTangleName]
+	if !has || tp.Root == nil {
+		return ErrMalfromedMsg{"group/exclude-member: missing group tangle", potential}
+	}
+	if err := checkGroupTangles(newExclude.Tangles, *tp.Root); err != nil {
+		return ErrMalfromedMsg{"group/exclude-member: " + err.Error(), potential}
+	}
+
+	*ge = GroupExcludeMember(newExclude)
+	return nil
+}
+
+func groupIDFromRecps(recps []AnyRef) (MessageRef, bool) {
+	if len(recps) == 0 {
+		return MessageRef{}, false
+	}
+	return recps[0].IsMessage()
+}
+
+// checkGroupRecps makes sure the first recipient is a cloaked group and the rest are at most maxFeeds feeds
+func checkGroupRecps(recps []AnyRef, maxFeeds int) error {
+	if len(recps) == 0 {
+		return fmt.Errorf("no recps")
+	}
+
+	group, ok := recps[0].IsMessage()
+	if !ok || group.Algo() != RefAlgoCloakedGroup {
+		return fmt.Errorf("first recipient needs to be the cloaked group ID")
+	}
+
+	feeds := recps[1:]
+	if len(feeds) > maxFeeds {
+		return fmt.Errorf("too many recipients: %d", len(recps))
+	}
+	for i, r := range feeds {
+		if _, ok := r.IsFeed(); !ok {
+			return fmt.Errorf("recipient %d is not a feed", i+1)
+		}
+	}
+	return nil
+}
+
+// checkGroupTangles makes sure the group and members tangles are rooted at the group/init message
+func checkGroupTangles(tangles Tangles, root MessageRef) error {
+	for _, name := range []string{GroupTangleName, MembersTangleName} {
+		tp, has := tangles[name]
+		if !has {
+			return fmt.Errorf("missing %s tangle", name)
+		}
+		if tp.Root == nil || !tp.Root.Equal(root) {
+			return fmt.Errorf("%s tangle is not rooted at the group/init message", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupContent(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		groupID, root MessageRef
+		bob, claire   FeedRef
+	)
+	groupID.algo = RefAlgoCloakedGroup
+	copy(groupID.hash[:], bytes.Repeat([]byte("G"), 32))
+	root.algo = RefAlgoMessageSSB1
+	copy(root.hash[:], bytes.Repeat([]byte("R"), 32))
+	bob.algo, claire.algo = RefAlgoFeedSSB1, RefAlgoFeedSSB1
+	copy(bob.id[:], bytes.Repeat([]byte("B"), 32))
+	copy(claire.id[:], bytes.Repeat([]byte("C"), 32))
+
+	groupKey := bytes.Repeat([]byte{7}, 32)
+
+	// init
+	out, err := json.Marshal(NewGroupInit("friends"))
+	r.NoError(err)
+	r.Equal(`{"type":"group/init","name":"friends","tangles":{"group":{"root":null,"previous":null}}}`, string(out))
+
+	var gi GroupInit
+	r.NoError(json.Unmarshal(out, &gi))
+	r.Equal("friends", gi.Name)
+
+	// add-member
+	add := NewGroupAddMember(groupID, groupKey, root, bob, claire)
+	add.Text = "welcome!"
+	out, err = json.Marshal(add)
+	r.NoError(err)
+
+	var gotAdd GroupAddMember
+	r.NoError(json.Unmarshal(out, &gotAdd))
+	gotID, ok := gotAdd.GroupID()
+	r.True(ok)
+	r.True(gotID.Equal(groupID))
+	members, ok := gotAdd.Members()
+	r.True(ok)
+	r.Equal([]FeedRef{bob, claire}, members)
+	r.Equal(groupKey, gotAdd.GroupKey)
+	r.Equal("welcome!", gotAdd.Text)
+	r.True(gotAdd.Root.Equal(root))
+
+	var asMap map[string]interface{}
+	r.NoError(json.Unmarshal(out, &asMap))
+	r.Equal(base64.StdEncoding.EncodeToString(groupKey), asMap["groupKey"])
+	r.Equal([]interface{}{groupID.Sigil(), bob.Sigil(), claire.Sigil()}, asMap["recps"])
+
+	// exclude-member
+	out, err = json.Marshal(NewGroupExcludeMember(groupID, root, claire))
+	r.NoError(err)
+
+	var gotExclude GroupExcludeMember
+	r.NoError(json.Unmarshal(out, &gotExclude))
+	r.Equal([]FeedRef{claire}, gotExclude.Excludes)
+	gotID, ok = gotExclude.GroupID()
+	r.True(ok)
+	r.True(gotID.Equal(groupID))
+
+	// registered
+	c, err := DecodeContent(Value{Content: out})
+	r.NoError(err)
+	r.IsType(&GroupExcludeMember{}, c)
+}
+
+func TestGroupRecpsAccessors(t *testing.T) {
+	r := require.New(t)
+
+	// zero values and hand-built messages didn't go through UnmarshalJSON
+	_, ok := GroupAddMember{}.GroupID()
+	r.False(ok)
+	_, ok = GroupAddMember{}.Members()
+	r.False(ok)
+	_, ok = GroupExcludeMember{}.GroupID()
+	r.False(ok)
+
+	groupID, err := NewMessageRefFromBytes(bytes.Repeat([]byte{1}, 32), RefAlgoCloakedGroup)
+	r.NoError(err)
+	feed, err := NewFeedRefFromBytes(bytes.Repeat([]byte{2}, 32), RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	onlyGroup := GroupAddMember{Recps: []AnyRef{NewAnyRef(groupID)}}
+	_, ok = onlyGroup.GroupID()
+	r.True(ok)
+	_, ok = onlyGroup.Members()
+	r.False(ok)
+
+	swapped := GroupAddMember{Recps: []AnyRef{NewAnyRef(feed), NewAnyRef(groupID)}}
+	_, ok = swapped.GroupID()
+	r.False(ok)
+	_, ok = swapped.Members()
+	r.False(ok)
+}
+
+func TestGroupContentInvalid(t *testing.T) {
+	const (
+		group  = "%R0dHR0dHR0dHR0dHR0dHR0dHR0dHR0dHR0dHR0dHR0c=.cloaked"
+		root   = "%UlJSUlJSUlJSUlJSUlJSUlJSUlJSUlJSUlJSUlJSUlI=.sha256"
+		other  = "%T1RIRVJPVEhFUk9USEVST1RIRVJPVEhFUk9USEVST1I=.sha256"
+		bob    = "@QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI=.ed25519"
+		key    = "BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc="
+		tangle = `"tangles":{"group":{"root":"` + root + `","previous":["` + root + `"]},"members":{"root":"` + root + `","previous":["` + root + `"]}}`
+	)
+
+	// the baselines are valid
+	var ga GroupAddMember
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"group/add-member","version":"v1","groupKey":"`+key+`","root":"`+root+`","recps":["`+group+`","`+bob+`"],`+tangle+`}`), &ga))
+	var ge GroupExcludeMember
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"group/exclude-member","excludes":["`+bob+`"],"recps":["`+group+`"],`+tangle+`}`), &ge))
+
+	var cases = []struct {
+		input  string
+		target json.Unmarshaler
+	}{
+		{`"Zm9v.box2"`, new(GroupInit)},
+		{`{"type":"group/init","tangles":{}}`, new(GroupInit)},
+		{`{"type":"group/init","tangles":{"group":{"root":"` + root + `","previous":["` + root + `"]}}}`, new(GroupInit)},
+
+		{`{"type":"group/add-member","version":"v2","groupKey":"` + key + `","root":"` + root + `","recps":["` + group + `","` + bob + `"],` + tangle + `}`, new(GroupAddMember)},
+		{`{"type":"group/add-member","version":"v1","groupKey":"c2hvcnQ=","root":"` + root + `","recps":["` + group + `","` + bob + `"],` + tangle + `}`, new(GroupAddMember)},
+		{`{"type":"group/add-member","version":"v1","groupKey":"` + key + `","root":"` + root + `","recps":["` + bob + `","` + group + `"],` + tangle + `}`, new(GroupAddMember)},
+		{`{"type":"group/add-member","version":"v1","groupKey":"` + key + `","root":"` + root + `","recps":["` + group + `"],` + tangle + `}`, new(GroupAddMember)},
+		{`{"type":"group/add-member","version":"v1","groupKey":"` + key + `","root":"` + other + `","recps":["` + group + `","` + bob + `"],` + tangle + `}`, new(GroupAddMember)},
+		{`{"type":"group/add-member","version":"v1","groupKey":"` + key + `","root":"` + root + `","recps":["` + group + `","` + bob + `"]}`, new(GroupAddMember)},
+
+		{`{"type":"group/exclude-member","excludes":[],"recps":["` + group + `"],` + tangle + `}`, new(GroupExcludeMember)},
+		{`{"type":"group/exclude-member","excludes":["` + bob + `"],"recps":["` + group + `","` + bob + `"],` + tangle + `}`, new(GroupExcludeMember)},
+		{`{"type":"group/exclude-member","excludes":["` + bob + `"],"recps":["` + group + `"]}`, new(GroupExcludeMember)},
+	}
+
+	for i, tc := range cases {
+		err := json.Unmarshal([]byte(tc.input), tc.target)
+		assert.True(t, IsMessageUnusable(err), "case %d: %v", i, err)
+	}
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+// Package ed2curve converts ed25519 signing keys to curve25519 keys for diffie-hellman,
+// the same way libsodium's crypto_sign_ed25519_*_to_curve25519 functions do.
+package ed2curve
+
+import (
+	"crypto/sha512"
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// ErrInvalidPublicKey is returned if the key has the wrong length or can't be mapped to a curve25519 point
+var ErrInvalidPublicKey = errors.New("ed2curve: invalid public key")
+
+// p = 2^255 - 19
+var fieldPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// PublicKey maps the edwards point of an ed25519 public key to the montgomery u coordinate: u = (1+y)/(1-y)
+func PublicKey(pub ed25519.PublicKey) ([32]byte, error) {
+	var out [32]byte
+	if len(pub) != ed25519.PublicKeySize {
+		return out, ErrInvalidPublicKey
+	}
+
+	// y is stored little-endian, the top bit is the sign of x
+	var be [32]byte
+	for i := range pub {
+		be[31-i] = pub[i]
+	}
+	be[0] &= 0x7f
+	y := new(big.Int).SetBytes(be[:])
+	if y.Cmp(fieldPrime) >= 0 {
+		return out, ErrInvalidPublicKey
+	}
+
+	one := big.NewInt(1)
+	num := new(big.Int).Add(one, y)
+	den := new(big.Int).Sub(one, y)
+	den.Mod(den, fieldPrime)
+	if den.Sign() == 0 {
+		return out, ErrInvalidPublicKey
+	}
+
+	u := num.Mul(num, den.ModInverse(den, fieldPrime))
+	u.Mod(u, fieldPrime)
+
+	ub := u.Bytes()
+	for i := range ub {
+		out[i] = ub[len(ub)-1-i]
+	}
+	return out, nil
+}
+
+// PrivateKey returns the clamped curve25519 scalar of an ed25519 private key
+func PrivateKey(priv ed25519.PrivateKey) [32]byte {
+	h := sha512.Sum512(priv.Seed())
+	h[0] &= 248
+	h[31] &= 127
+	h[31] |= 64
+
+	var out [32]byte
+	copy(out[:], h[:32])
+	return out
+}
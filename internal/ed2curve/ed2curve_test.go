@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package ed2curve
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestConversion(t *testing.T) {
+	r := require.New(t)
+
+	pubA, privA, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte("a"), 64)))
+	r.NoError(err)
+	pubB, privB, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte("b"), 64)))
+	r.NoError(err)
+
+	curvePubA, err := PublicKey(pubA)
+	r.NoError(err)
+	curvePubB, err := PublicKey(pubB)
+	r.NoError(err)
+	curvePrivA, curvePrivB := PrivateKey(privA), PrivateKey(privB)
+
+	// the converted public key is the one of the converted private key
+	derived, err := curve25519.X25519(curvePrivA[:], curve25519.Basepoint)
+	r.NoError(err)
+	r.Equal(curvePubA[:], derived)
+
+	// both sides agree on the shared secret
+	sharedA, err := curve25519.X25519(curvePrivA[:], curvePubB[:])
+	r.NoError(err)
+	sharedB, err := curve25519.X25519(curvePrivB[:], curvePubA[:])
+	r.NoError(err)
+	r.Equal(sharedA, sharedB)
+}
+
+func TestPublicKeyVector(t *testing.T) {
+	r := require.New(t)
+
+	// from libsodium's test/default/ed25519_convert.c
+	seed, _ := hex.DecodeString("421151a459faeade3d247115f94aedae42318124095afabe4d1451a559faedee")
+	priv := ed25519.NewKeyFromSeed(seed)
+
+	curvePub, err := PublicKey(priv.Public().(ed25519.PublicKey))
+	r.NoError(err)
+	r.Equal("f1814f0e8ff1043d8a44d25babff3cedcae6c22c3edaa48f857ae70de2baae50", hex.EncodeToString(curvePub[:]))
+
+	curvePriv := PrivateKey(priv)
+	r.Equal("8052030376d47112be7f73ed7a019293dd12ad910b654455798b4667d73de166", hex.EncodeToString(curvePriv[:]))
+}
+
+func TestPublicKeyInvalid(t *testing.T) {
+	_, err := PublicKey(make([]byte, 31))
+	require.ErrorIs(t, err, ErrInvalidPublicKey)
+
+	// y = 1 is the identity, which has no montgomery form
+	identity := make([]byte, 32)
+	identity[0] = 1
+	_, err = PublicKey(identity)
+	require.ErrorIs(t, err, ErrInvalidPublicKey)
+}
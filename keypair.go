@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// KeyPair is the ed25519 keypair of a classic feed
+type KeyPair struct {
+	Feed FeedRef
+
+	Private ed25519.PrivateKey
+}
+
+// NewKeyPair generates a new keypair. If r is nil, crypto/rand is used.
+func NewKeyPair(r io.Reader) (KeyPair, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+
+	pub, priv, err := ed25519.GenerateKey(r)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("ssb/keypair: failed to generate key: %w", err)
+	}
+
+	feed, err := NewFeedRefFromBytes(pub, RefAlgoFeedSSB1)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return KeyPair{Feed: feed, Private: priv}, nil
+}
+
+// NewKeyPairFromPrivate returns the keypair of an existing private key
+func NewKeyPairFromPrivate(priv ed25519.PrivateKey) (KeyPair, error) {
+	if n := len(priv); n != ed25519.PrivateKeySize {
+		return KeyPair{}, fmt.Errorf("ssb/keypair: private key has wrong length %d", n)
+	}
+
+	feed, err := NewFeedRefFromBytes(priv.Public().(ed25519.PublicKey), RefAlgoFeedSSB1)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return KeyPair{Feed: feed, Private: priv}, nil
+}
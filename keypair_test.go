@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyPair(t *testing.T) {
+	r := require.New(t)
+
+	kp, err := NewKeyPair(bytes.NewReader(bytes.Repeat([]byte("k"), 64)))
+	r.NoError(err)
+	r.Equal(RefAlgoFeedSSB1, kp.Feed.Algo())
+	r.Equal([]byte(kp.Feed.PubKey()), []byte(kp.Private[32:]))
+
+	same, err := NewKeyPairFromPrivate(kp.Private)
+	r.NoError(err)
+	r.True(same.Feed.Equal(kp.Feed))
+
+	_, err = NewKeyPairFromPrivate(kp.Private[:32])
+	r.Error(err)
+
+	random, err := NewKeyPair(nil)
+	r.NoError(err)
+	r.False(random.Feed.Equal(kp.Feed))
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// ErrInvalidLegacyInvite is returned (wrapped) if a legacy pub invite can't be parsed
+var ErrInvalidLegacyInvite = errors.New("ssb: invalid legacy invite")
+
+// LegacyInvite is an old-style pub invite code: host:port:@key.ed25519~seed
+// The seed is used to derive the ed25519 keypair of the guest that is allowed to call invite.use on the pub.
+type LegacyInvite struct {
+	Address OldAddress
+
+	Seed []byte
+}
+
+// NewLegacyInvite creates an invite for the pub at addr with a fresh random seed
+func NewLegacyInvite(addr OldAddress) (LegacyInvite, error) {
+	return newLegacyInvite(addr, rand.Reader)
+}
+
+func newLegacyInvite(addr OldAddress, r io.Reader) (LegacyInvite, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(r, seed); err != nil {
+		return LegacyInvite{}, fmt.Errorf("legacy invite: failed to read seed: %w", err)
+	}
+	return LegacyInvite{Address: addr, Seed: seed}, nil
+}
+
+// ParseLegacyInvite parses an invite code of the form host:port:@key.ed25519~seed
+func ParseLegacyInvite(input string) (LegacyInvite, error) {
+	var inv LegacyInvite
+
+	tilde := strings.LastIndex(input, "~")
+	if tilde < 0 {
+		return inv, fmt.Errorf("no seed: %w", ErrInvalidLegacyInvite)
+	}
+	addr, seedStr := input[:tilde], input[tilde+1:]
+
+	keyStart := strings.LastIndex(addr, ":@")
+	if keyStart < 0 {
+		return inv, fmt.Errorf("no pub key: %w", ErrInvalidLegacyInvite)
+	}
+	hostPort, keyStr := addr[:keyStart], addr[keyStart+1:]
+
+	portStart := strings.LastIndex(hostPort, ":")
+	if portStart < 0 {
+		return inv, fmt.Errorf("expected host:port: %w", ErrInvalidLegacyInvite)
+	}
+	inv.Address.Host = strings.Trim(hostPort[:portStart], "[]")
+	if inv.Address.Host == "" {
+		return inv, fmt.Errorf("empty host: %w", ErrInvalidLegacyInvite)
+	}
+
+	port, err := strconv.Atoi(hostPort[portStart+1:])
+	if err != nil || port < 1 || port > 65535 {
+		return inv, fmt.Errorf("invalid port: %q: %w", hostPort[portStart+1:], ErrInvalidLegacyInvite)
+	}
+	inv.Address.Port = port
+
+	inv.Address.Key, err = ParseFeedRef(keyStr)
+	if err != nil {
+		return inv, fmt.Errorf("invalid pub key: %s: %w", err, ErrInvalidLegacyInvite)
+	}
+
+	inv.Seed, err = base64.StdEncoding.DecodeString(seedStr)
+	if err != nil {
+		return inv, fmt.Errorf("seed is not base64: %w", ErrInvalidLegacyInvite)
+	}
+	if n := len(inv.Seed); n != ed25519.SeedSize {
+		return inv, fmt.Errorf("seed has wrong length %d: %w", n, ErrInvalidLegacyInvite)
+	}
+
+	return inv, nil
+}
+
+// String returns the invite code as host:port:@key.ed25519~seed
+func (inv LegacyInvite) String() string {
+	hostPort := net.JoinHostPort(inv.Address.Host, strconv.Itoa(inv.Address.Port))
+	return hostPort + ":" + inv.Address.Key.Sigil() + "~" + base64.StdEncoding.EncodeToString(inv.Seed)
+}
+
+// Feed returns the feed of the pub that issued the invite
+func (inv LegacyInvite) Feed() FeedRef { return inv.Address.Key }
+
+// GuestKey returns the keypair that is derived from the seed
+func (inv LegacyInvite) GuestKey() ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(inv.Seed)
+}
+
+// MultiserverAddress returns the address of the pub with the seed in the shs transform: net:host:port~shs:key:seed
+func (inv LegacyInvite) MultiserverAddress() MultiserverAddress {
+	ma := inv.Address.MultiserverAddress()
+	ma.Transforms[0].Seed = inv.Seed
+	return ma
+}
+
+// Action returns the add-pub action for the invite.
+// Its URI is the same as the one MSAddrWithSeed builds for the address and seed of the invite.
+func (inv LegacyInvite) Action() AddPubAction {
+	return AddPubAction{MultiserverAddress: inv.MultiserverAddress()}
+}
+
+// LegacyInviteFromAction turns an add-pub action back into an invite.
+// The address needs to use the net transport and an shs transform with a seed, like MSAddrWithSeed produces.
+// Plain MSAddr URIs don't carry a seed and are rejected.
+func LegacyInviteFromAction(a AddPubAction) (LegacyInvite, error) {
+	var inv LegacyInvite
+
+	t := a.MultiserverAddress.Transport
+	if t.Name != "net" {
+		return inv, fmt.Errorf("unsupported transport %q: %w", t.Name, ErrInvalidLegacyInvite)
+	}
+
+	for _, tf := range a.MultiserverAddress.Transforms {
+		if tf.Name != "shs" {
+			continue
+		}
+		if n := len(tf.Seed); n != ed25519.SeedSize {
+			return inv, fmt.Errorf("shs transform without seed: %w", ErrInvalidLegacyInvite)
+		}
+
+		key, err := NewFeedRefFromBytes(tf.Key, RefAlgoFeedSSB1)
+		if err != nil {
+			return inv, fmt.Errorf("invalid pub key: %s: %w", err, ErrInvalidLegacyInvite)
+		}
+
+		inv.Address = OldAddress{Host: t.Host, Port: t.Port, Key: key}
+		inv.Seed = tf.Seed
+		return inv, nil
+	}
+
+	return inv, fmt.Errorf("no shs transform: %w", ErrInvalidLegacyInvite)
+}
+
+// ParseLegacyInviteURI parses an ssb:experimental?action=add-pub URI into an invite
+func ParseLegacyInviteURI(input string) (LegacyInvite, error) {
+	action, err := ParseExperimentalAction(input)
+	if err != nil {
+		return LegacyInvite{}, err
+	}
+
+	addPub, ok := action.(AddPubAction)
+	if !ok {
+		return LegacyInvite{}, fmt.Errorf("expected %s action but got %s: %w", ActionAddPub, action.Action(), ErrInvalidLegacyInvite)
+	}
+
+	return LegacyInviteFromAction(addPub)
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLegacyInvite(t *testing.T) {
+	const (
+		key  = "+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU="
+		seed = "ye+QM09iPcDJD6YvQYjoQc7sLF/IFhmNbEqgdzQo3lQ="
+	)
+
+	type tcase struct {
+		input string
+		host  string
+		port  int
+	}
+
+	var cases = []tcase{
+		{"pub.example:8008:@" + key + ".ed25519~" + seed, "pub.example", 8008},
+		{"10.0.0.1:8009:@" + key + ".ed25519~" + seed, "10.0.0.1", 8009},
+		{"[::1]:8008:@" + key + ".ed25519~" + seed, "::1", 8008},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			r := require.New(t)
+
+			inv, err := ParseLegacyInvite(tc.input)
+			r.NoError(err)
+			r.Equal(tc.host, inv.Address.Host)
+			r.Equal(tc.port, inv.Address.Port)
+			r.Equal("@"+key+".ed25519", inv.Feed().Sigil())
+			r.Len(inv.Seed, 32)
+			r.Equal(tc.input, inv.String())
+
+			// add-pub URI and back
+			uri := inv.Action().String()
+			got, err := ParseLegacyInviteURI(uri)
+			r.NoError(err)
+			r.Equal(inv, got)
+		})
+	}
+}
+
+func TestParseLegacyInviteInvalid(t *testing.T) {
+	const (
+		key  = "+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU="
+		seed = "ye+QM09iPcDJD6YvQYjoQc7sLF/IFhmNbEqgdzQo3lQ="
+	)
+
+	var cases = []string{
+		"",
+		"pub.example:8008:@" + key + ".ed25519",
+		"pub.example:8008~" + seed,
+		"pub.example:@" + key + ".ed25519~" + seed,
+		":8008:@" + key + ".ed25519~" + seed,
+		"pub.example:nope:@" + key + ".ed25519~" + seed,
+		"pub.example:8008:@nope.ed25519~" + seed,
+		"pub.example:8008:@" + key + ".ed25519~not*base64",
+		"pub.example:8008:@" + key + ".ed25519~c2hvcnQ=",
+	}
+
+	for _, input := range cases {
+		_, err := ParseLegacyInvite(input)
+		assert.True(t, errors.Is(err, ErrInvalidLegacyInvite), "%q: %v", input, err)
+	}
+}
+
+func TestLegacyInviteFromMSAddr(t *testing.T) {
+	r := require.New(t)
+
+	pub, err := ParseFeedRef("@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519")
+	r.NoError(err)
+
+	// plain add-pub URIs from MSAddr don't carry a seed
+	u, err := NewExperimentalURI(MSAddr("pub.example:8008", pub.PubKey()))
+	r.NoError(err)
+	_, err = ParseLegacyInviteURI(u.String())
+	r.True(errors.Is(err, ErrInvalidLegacyInvite))
+
+	inv, err := newLegacyInvite(OldAddress{Host: "pub.example", Port: 8008, Key: pub}, bytes.NewReader(bytes.Repeat([]byte{1}, 32)))
+	r.NoError(err)
+	r.Equal(bytes.Repeat([]byte{1}, 32), inv.Seed)
+	r.Equal("net:pub.example:8008~shs:+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=", inv.MultiserverAddress().String())
+
+	// MSAddrWithSeed and the invite produce the same URI, in both directions
+	u, err = NewExperimentalURI(MSAddrWithSeed("pub.example:8008", pub.PubKey(), inv.Seed))
+	r.NoError(err)
+	r.Equal(inv.Action().String(), u.String())
+
+	fromURI, err := ParseLegacyInviteURI(u.String())
+	r.NoError(err)
+	r.Equal(inv, fromURI)
+
+	_, err = NewExperimentalURI(MSAddrWithSeed("pub.example:8008", pub.PubKey(), []byte("short")))
+	r.Error(err)
+	r.Len(inv.GuestKey(), 64)
+
+	_, err = newLegacyInvite(inv.Address, bytes.NewReader(nil))
+	r.Error(err)
+
+	fresh, err := NewLegacyInvite(inv.Address)
+	r.NoError(err)
+	r.NotEqual(inv.Seed, fresh.Seed)
+}
@@ -5,6 +5,7 @@
 package refs
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -111,20 +112,29 @@ func (c *Contact) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-// About represents metadata updates about a feed like name, descriptin or image
+// About represents metadata updates about a feed like name, descriptin or image.
+// It can also be about a message (like a gathering) or a #channel.
 type About struct {
-	Type        string   `json:"type"`
-	About       FeedRef  `json:"about"`
+	Type string `json:"type"`
+
+	// About used to be a FeedRef. Use Feed() where only abouts of feeds matter.
+	About AnyRef `json:"about"`
+
 	Name        string   `json:"name,omitempty"`
 	Description string   `json:"description,omitempty"`
 	Image       *BlobRef `json:"image,omitempty"`
 }
 
+// Feed returns the feed the message is about. It returns false if it is about a message or a channel.
+func (a About) Feed() (FeedRef, bool) {
+	return a.About.IsFeed()
+}
+
 // NewAboutName creats a new message to update one's name
 func NewAboutName(who FeedRef, name string) *About {
 	return &About{
 		Type:  "about",
-		About: who,
+		About: AnyRef{r: who},
 		Name:  name,
 	}
 }
@@ -133,7 +143,7 @@ func NewAboutName(who FeedRef, name string) *About {
 func NewAboutImage(who FeedRef, img *BlobRef) *About {
 	return &About{
 		Type:  "about",
-		About: who,
+		About: AnyRef{r: who},
 		Image: img,
 	}
 }
@@ -168,10 +178,13 @@ func (a *About) UnmarshalJSON(b []byte) error {
 		return ErrMalfromedMsg{"about: no string about field on type:about", potential}
 	}
 
-	newA.About, err = ParseFeedRef(about)
+	aboutJSON, err := json.Marshal(about)
 	if err != nil {
 		return fmt.Errorf("about: who?: %w", err)
 	}
+	if err := newA.About.UnmarshalJSON(aboutJSON); err != nil {
+		return fmt.Errorf("about: who?: %w", err)
+	}
 
 	if newName, ok := potential["name"].(string); ok {
 		newA.Name = newName
@@ -232,15 +245,22 @@ type Post struct {
 	Branch   MessageRefs `json:"branch,omitempty"`
 	Mentions []Mention   `json:"mentions,omitempty"`
 
+	// Channel is the name of the channel the post is in, without the #
+	Channel string `json:"channel,omitempty"`
+
 	Tangles Tangles `json:"tangles,omitempty"`
 
-	// Recipients of a message
-	Recps MessageRefs `json:"recps,omitempty"`
+	// Recipients of a message, feeds for box1 and also groups for box2.
+	// It used to be MessageRefs, which can't hold feeds.
+	Recps []AnyRef `json:"recps,omitempty"`
 }
 
 // Tangles represent a set of tangle information ala ssb-tangles v2 ( https://gitlab.com/tangle-js/tangle-graph )
 // for general information about tangles, you might want to read:
 // https://github.com/cn-uofbasel/ssbdrv/blob/1f7e6b11373ef6f73415f0e9c62f1ade29739251/doc/tangle.md
+//
+// Since TanglePoint is decoded strictly, a single malformed point makes the whole content fail to decode.
+// The common {"root":null,"previous":[]} for a root is accepted, though.
 type Tangles map[string]TanglePoint
 
 // TanglePoint represent a single reference point to a common message (root)
@@ -251,6 +271,133 @@ type TanglePoint struct {
 	Previous MessageRefs `json:"previous"`
 }
 
+var (
+	_ json.Marshaler   = (*TanglePoint)(nil)
+	_ json.Unmarshaler = (*TanglePoint)(nil)
+)
+
+// MarshalJSON writes the point the way ssb-tangle does.
+// Root points are written as {"root":null,"previous":null}, all others need a root and at least one previous.
+func (tp TanglePoint) MarshalJSON() ([]byte, error) {
+	if tp.Root == nil {
+		if len(tp.Previous) != 0 {
+			return nil, fmt.Errorf("root point with previous: %w", ErrInvalidTanglePoint)
+		}
+		return []byte(`{"root":null,"previous":null}`), nil
+	}
+
+	if len(tp.Previous) == 0 {
+		return nil, fmt.Errorf("non-root point without previous: %w", ErrInvalidTanglePoint)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"root":`)
+	if err := writeJSONRef(&buf, *tp.Root); err != nil {
+		return nil, err
+	}
+	buf.WriteString(`,"previous":[`)
+	for i, p := range tp.Previous {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSONRef(&buf, p); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes(), nil
+}
+
+func writeJSONRef(buf *bytes.Buffer, r MessageRef) error {
+	txt, err := r.MarshalText()
+	if err != nil {
+		return err
+	}
+	enc, err := json.Marshal(string(txt))
+	if err != nil {
+		return err
+	}
+	buf.Write(enc)
+	return nil
+}
+
+// UnmarshalJSON strictly decodes a tangle point.
+// Both fields need to be present and no others are allowed.
+// A root point needs to be {"root":null,"previous":null}, all others need a root and at least one previous.
+// An empty array for previous is treated like null, since many clients write root points that way.
+// For compatability with tangles v1, previous can also be a single reference instead of an array.
+func (tp *TanglePoint) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return fmt.Errorf("not an object: %s: %w", err, ErrInvalidTanglePoint)
+	}
+	if fields == nil {
+		return fmt.Errorf("point is null: %w", ErrInvalidTanglePoint)
+	}
+
+	rawRoot, hasRoot := fields["root"]
+	rawPrev, hasPrev := fields["previous"]
+	if !hasRoot || !hasPrev {
+		return fmt.Errorf("root and previous are required: %w", ErrInvalidTanglePoint)
+	}
+	if n := len(fields); n != 2 {
+		return fmt.Errorf("unexpected number of fields (%d): %w", n, ErrInvalidTanglePoint)
+	}
+
+	isNull := func(raw json.RawMessage) bool {
+		return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+	}
+	if bytes.Equal(bytes.Join(bytes.Fields(rawPrev), nil), []byte("[]")) {
+		rawPrev = json.RawMessage("null")
+	}
+
+	var newPoint TanglePoint
+
+	if isNull(rawRoot) {
+		if !isNull(rawPrev) {
+			return fmt.Errorf("root point needs previous:null: %w", ErrInvalidTanglePoint)
+		}
+		*tp = newPoint
+		return nil
+	}
+
+	var rootStr string
+	if err := json.Unmarshal(rawRoot, &rootStr); err != nil {
+		return fmt.Errorf("root is not a string: %s: %w", err, ErrInvalidTanglePoint)
+	}
+	root, err := ParseMessageRef(rootStr)
+	if err != nil {
+		return fmt.Errorf("invalid root: %w", err)
+	}
+	newPoint.Root = &root
+
+	if isNull(rawPrev) {
+		return fmt.Errorf("non-root point without previous: %w", ErrInvalidTanglePoint)
+	}
+
+	var prevStrs []string
+	var single string
+	if err := json.Unmarshal(rawPrev, &single); err == nil {
+		prevStrs = []string{single}
+	} else if err := json.Unmarshal(rawPrev, &prevStrs); err != nil {
+		return fmt.Errorf("previous is neither a string nor an array of them: %s: %w", err, ErrInvalidTanglePoint)
+	}
+	if len(prevStrs) == 0 {
+		return fmt.Errorf("non-root point without previous: %w", ErrInvalidTanglePoint)
+	}
+
+	newPoint.Previous = make(MessageRefs, len(prevStrs))
+	for i, p := range prevStrs {
+		newPoint.Previous[i], err = ParseMessageRef(p)
+		if err != nil {
+			return fmt.Errorf("invalid previous %d: %w", i, err)
+		}
+	}
+
+	*tp = newPoint
+	return nil
+}
+
 // Mention can link feeds/authors by name, channels or other messages.
 type Mention struct {
 	Link AnyRef `json:"link,omitempty"`
@@ -293,6 +440,180 @@ type OldAddress struct {
 	Key  FeedRef `json:"key"`
 }
 
+// MultiserverAddress returns the address as net:host:port~shs:key
+func (oa OldAddress) MultiserverAddress() MultiserverAddress {
+	return MultiserverAddress{
+		Transport:  MultiserverTransport{Name: "net", Host: oa.Host, Port: oa.Port},
+		Transforms: []MultiserverTransform{{Name: "shs", Key: oa.Key.PubKey()}},
+	}
+}
+
+// PubMessage announces a pub (type:pub).
+// Older clients use the object form of OldAddress, newer ones a multiserver address string. Both are supported.
+type PubMessage struct {
+	Type    string             `json:"type"`
+	Address MultiserverAddress `json:"address"`
+}
+
+// NewPubMessage returns an initialzed type:pub message
+func NewPubMessage(addr MultiserverAddress) PubMessage {
+	return PubMessage{Type: "pub", Address: addr}
+}
+
+// UnmarshalJSON implements JSON deserialization of type:pub
+func (pm *PubMessage) UnmarshalJSON(b []byte) error {
+	potential, err := unmarshalTypedMap(b, "pub")
+	if err != nil {
+		return err
+	}
+
+	newPub := PubMessage{Type: "pub"}
+
+	switch addr := potential["address"].(type) {
+	case string:
+		newPub.Address, err = ParseMultiserverAddress(addr)
+		if err != nil {
+			return fmt.Errorf("pub: invalid address: %w", err)
+		}
+
+	case map[string]interface{}:
+		var old OldAddress
+		host, _ := addr["host"].(string)
+		port, _ := addr["port"].(float64)
+		key, _ := addr["key"].(string)
+		if host == "" || port <= 0 || port > 65535 || key == "" {
+			return ErrMalfromedMsg{"pub: incomplete address object", potential}
+		}
+		old.Host = host
+		old.Port = int(port)
+		old.Key, err = ParseFeedRef(key)
+		if err != nil {
+			return fmt.Errorf("pub: invalid address key: %w", err)
+		}
+		newPub.Address = old.MultiserverAddress()
+
+	default:
+		return ErrMalfromedMsg{"pub: no address on type:pub", potential}
+	}
+
+	if _, ok := newPub.Address.Feed(); !ok {
+		return ErrMalfromedMsg{"pub: address without shs key", potential}
+	}
+
+	*pm = newPub
+	return nil
+}
+
+// AddressMessage announces a multiserver address of the author (type:address)
+type AddressMessage struct {
+	Type    string             `json:"type"`
+	Address MultiserverAddress `json:"address"`
+}
+
+// NewAddressMessage returns an initialzed type:address message
+func NewAddressMessage(addr MultiserverAddress) AddressMessage {
+	return AddressMessage{Type: "address", Address: addr}
+}
+
+// UnmarshalJSON implements JSON deserialization of type:address
+func (am *AddressMessage) UnmarshalJSON(b []byte) error {
+	potential, err := unmarshalTypedMap(b, "address")
+	if err != nil {
+		return err
+	}
+
+	addr, ok := potential["address"].(string)
+	if !ok {
+		return ErrMalfromedMsg{"address: no string address field on type:address", potential}
+	}
+
+	newAddr := AddressMessage{Type: "address"}
+	newAddr.Address, err = ParseMultiserverAddress(addr)
+	if err != nil {
+		return fmt.Errorf("address: invalid address: %w", err)
+	}
+
+	*am = newAddr
+	return nil
+}
+
+// The actions of type:room/alias messages
+const (
+	RoomAliasRegistered = "registered"
+	RoomAliasRevoked    = "revoked"
+)
+
+// RoomAliasMessage is published by a user after registering (or revoking) an alias on a rooms2 server (type:room/alias).
+// It only references the room by its key, the multiserver address of the room needs to be fetched by resolving the alias URL.
+type RoomAliasMessage struct {
+	Type     string  `json:"type"`
+	Action   string  `json:"action"`
+	Alias    string  `json:"alias"`
+	AliasURL string  `json:"aliasURL"`
+	Room     FeedRef `json:"room"`
+}
+
+// UnmarshalJSON implements JSON deserialization of type:room/alias
+func (ram *RoomAliasMessage) UnmarshalJSON(b []byte) error {
+	potential, err := unmarshalTypedMap(b, "room/alias")
+	if err != nil {
+		return err
+	}
+
+	newRAM := RoomAliasMessage{Type: "room/alias"}
+
+	newRAM.Action, _ = potential["action"].(string)
+	if newRAM.Action != RoomAliasRegistered && newRAM.Action != RoomAliasRevoked {
+		return ErrMalfromedMsg{"room/alias: unknown action", potential}
+	}
+
+	newRAM.Alias, _ = potential["alias"].(string)
+	if !IsValidRoomAlias(newRAM.Alias) {
+		return ErrMalfromedMsg{"room/alias: invalid alias", potential}
+	}
+
+	newRAM.AliasURL, _ = potential["aliasURL"].(string)
+	if newRAM.Action == RoomAliasRegistered && newRAM.AliasURL == "" {
+		return ErrMalfromedMsg{"room/alias: registration without aliasURL", potential}
+	}
+
+	room, ok := potential["room"].(string)
+	if !ok {
+		return ErrMalfromedMsg{"room/alias: no string room field", potential}
+	}
+	newRAM.Room, err = ParseFeedRef(room)
+	if err != nil {
+		return fmt.Errorf("room/alias: invalid room: %w", err)
+	}
+
+	*ram = newRAM
+	return nil
+}
+
+// unmarshalTypedMap decodes b as a map and checks that it has the wanted type
+func unmarshalTypedMap(b []byte, want string) (map[string]interface{}, error) {
+	if len(b) > 0 && b[0] == '"' {
+		return nil, ErrWrongType{want: want, has: "private.box?"}
+	}
+
+	var potential map[string]interface{}
+	err := json.Unmarshal(b, &potential)
+	if err != nil {
+		return nil, fmt.Errorf("%s: map stage failed: %w", want, err)
+	}
+
+	t, ok := potential["type"].(string)
+	if !ok {
+		return nil, ErrMalfromedMsg{want + ": no type on message", nil}
+	}
+
+	if t != want {
+		return nil, ErrWrongType{want: want, has: t}
+	}
+
+	return potential, nil
+}
+
 // KeyValueRaw uses json.RawMessage for the content portion, this helps of the content needs to be deserialzed manually or not at all
 type KeyValueRaw struct {
 	Key_      MessageRef `json:"key"` // Key_ is using the underline here to not conflict with the refs.Message interface (for history ceasons)
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPubKey = "+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU="
+
+func TestPubMessage(t *testing.T) {
+	r := require.New(t)
+
+	var cases = []string{
+		`{"type":"pub","address":{"host":"pub.example","port":8008,"key":"@` + testPubKey + `.ed25519"}}`,
+		`{"type":"pub","address":"net:pub.example:8008~shs:` + testPubKey + `"}`,
+	}
+
+	for i, input := range cases {
+		var pub PubMessage
+		r.NoError(json.Unmarshal([]byte(input), &pub), "case %d", i)
+
+		r.Equal("net:pub.example:8008~shs:"+testPubKey, pub.Address.String())
+		fr, ok := pub.Address.Feed()
+		r.True(ok)
+		r.Equal("@"+testPubKey+".ed25519", fr.Sigil())
+	}
+
+	out, err := json.Marshal(NewPubMessage(mustParseMSAddr(t, "net:pub.example:8008~shs:"+testPubKey)))
+	r.NoError(err)
+	r.Equal(cases[1], string(out))
+}
+
+func TestAddressMessage(t *testing.T) {
+	r := require.New(t)
+
+	input := `{"type":"address","address":"net:10.0.0.1:8008~shs:` + testPubKey + `"}`
+
+	var am AddressMessage
+	r.NoError(json.Unmarshal([]byte(input), &am))
+	r.Equal("10.0.0.1:8008", am.Address.HostPort())
+
+	out, err := json.Marshal(am)
+	r.NoError(err)
+	r.Equal(input, string(out))
+}
+
+func TestRoomAliasMessage(t *testing.T) {
+	r := require.New(t)
+
+	input := `{"type":"room/alias","action":"registered","alias":"bob","aliasURL":"https://bob.room.example","room":"@` + testPubKey + `.ed25519"}`
+
+	var ram RoomAliasMessage
+	r.NoError(json.Unmarshal([]byte(input), &ram))
+	r.Equal(RoomAliasRegistered, ram.Action)
+	r.Equal("bob", ram.Alias)
+	r.Equal("https://bob.room.example", ram.AliasURL)
+	r.Equal("@"+testPubKey+".ed25519", ram.Room.Sigil())
+
+	out, err := json.Marshal(ram)
+	r.NoError(err)
+	r.Equal(input, string(out))
+}
+
+func TestAddressContentUnusable(t *testing.T) {
+	var cases = []struct {
+		input  string
+		target json.Unmarshaler
+	}{
+		{`"boxed.box"`, new(PubMessage)},
+		{`{"type":"post"}`, new(PubMessage)},
+		{`{"type":"pub"}`, new(PubMessage)},
+		{`{"type":"pub","address":{"host":"pub.example","key":"@` + testPubKey + `.ed25519"}}`, new(PubMessage)},
+		{`{"type":"pub","address":"net:pub.example:8008"}`, new(PubMessage)},
+		{`{"type":"address","address":23}`, new(AddressMessage)},
+		{`{"about":"me"}`, new(AddressMessage)},
+		{`{"type":"room/alias","action":"lost","alias":"bob","room":"@` + testPubKey + `.ed25519"}`, new(RoomAliasMessage)},
+		{`{"type":"room/alias","action":"registered","alias":"Bob!","aliasURL":"https://x","room":"@` + testPubKey + `.ed25519"}`, new(RoomAliasMessage)},
+		{`{"type":"room/alias","action":"registered","alias":"bob","room":"@` + testPubKey + `.ed25519"}`, new(RoomAliasMessage)},
+	}
+
+	for i, tc := range cases {
+		err := json.Unmarshal([]byte(tc.input), tc.target)
+		assert.True(t, IsMessageUnusable(err), "case %d: %v", i, err)
+	}
+
+	// invalid addresses are errors but not of the unusable kind
+	var am AddressMessage
+	err := json.Unmarshal([]byte(`{"type":"address","address":"net:nope"}`), &am)
+	assert.Error(t, err)
+}
+
+func mustParseMSAddr(t *testing.T, s string) MultiserverAddress {
+	ma, err := ParseMultiserverAddress(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ma
+}
+
+func TestPostRecpsObjectForm(t *testing.T) {
+	r := require.New(t)
+
+	// Patchwork writes recps as mention objects, other clients as plain strings
+	input := `{
+		"type": "post",
+		"text": "hey you two",
+		"recps": [
+			{"link": "@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519", "name": "alice"},
+			"@ye+QM09iPcDJD6YvQYjoQc7sLF/IFhmNbEqgdzQo3lQ=.ed25519"
+		],
+		"mentions": [
+			{"link": "@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519", "name": "alice"}
+		]
+	}`
+
+	var p Post
+	r.NoError(json.Unmarshal([]byte(input), &p))
+	r.Len(p.Recps, 2)
+
+	alice, ok := p.Recps[0].IsFeed()
+	r.True(ok)
+	r.Equal("@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519", alice.String())
+
+	bob, ok := p.Recps[1].IsFeed()
+	r.True(ok)
+	r.Equal("@ye+QM09iPcDJD6YvQYjoQc7sLF/IFhmNbEqgdzQo3lQ=.ed25519", bob.String())
+
+	// written back as strings
+	out, err := json.Marshal(p.Recps)
+	r.NoError(err)
+	r.Equal(`["@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519","@ye+QM09iPcDJD6YvQYjoQc7sLF/IFhmNbEqgdzQo3lQ=.ed25519"]`, string(out))
+
+	for _, invalid := range []string{`{"name":"alice"}`, `{"link":23}`, `{"link":"nope"}`} {
+		var ar AnyRef
+		r.Error(json.Unmarshal([]byte(invalid), &ar), invalid)
+	}
+}
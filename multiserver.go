@@ -0,0 +1,360 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// ErrInvalidMultiserverAddress is returned (wrapped) if a multiserver address can't be parsed
+var ErrInvalidMultiserverAddress = errors.New("ssb: invalid multiserver address")
+
+// MultiserverAddress is a single multiserver address, a transport followed by the transforms that are applied to it.
+// For instance net:example.com:8008~shs:key, see https://github.com/ssbc/multiserver for the details.
+type MultiserverAddress struct {
+	Transport  MultiserverTransport
+	Transforms []MultiserverTransform
+}
+
+// MultiserverTransport is the first part of an address and says how to connect to a peer.
+// Known names are net, onion, ws, wss and tunnel.
+type MultiserverTransport struct {
+	Name string
+
+	// net, onion, ws and wss.
+	// Port is zero for websocket addresses without an explicit port.
+	Host string
+	Port int
+
+	// Path is only used by ws and wss
+	Path string
+
+	// Portal and Target are only used by tunnel
+	Portal, Target FeedRef
+}
+
+// MultiserverTransform is applied on top of a transport.
+// Known names are shs (secret-handshake) and noauth.
+type MultiserverTransform struct {
+	Name string
+
+	// Key is the public key of the peer for shs
+	Key ed25519.PublicKey
+
+	// Seed is the optional private seed of an invite for shs
+	Seed []byte
+}
+
+// NewNetMultiserverAddress returns a net:host:port~shs:key address
+func NewNetMultiserverAddress(hostAndPort string, pubKey ed25519.PublicKey) (MultiserverAddress, error) {
+	host, portStr, err := net.SplitHostPort(hostAndPort)
+	if err != nil {
+		return MultiserverAddress{}, fmt.Errorf("%s: %w", err, ErrInvalidMultiserverAddress)
+	}
+
+	port, err := parseMultiserverPort(portStr)
+	if err != nil {
+		return MultiserverAddress{}, err
+	}
+
+	if n := len(pubKey); n != ed25519.PublicKeySize {
+		return MultiserverAddress{}, fmt.Errorf("shs key has wrong length %d: %w", n, ErrInvalidMultiserverAddress)
+	}
+
+	return MultiserverAddress{
+		Transport:  MultiserverTransport{Name: "net", Host: host, Port: port},
+		Transforms: []MultiserverTransform{{Name: "shs", Key: pubKey}},
+	}, nil
+}
+
+// ParseMultiserverAddress parses a single address, like net:host:port~shs:key.
+func ParseMultiserverAddress(input string) (MultiserverAddress, error) {
+	var ma MultiserverAddress
+
+	parts := strings.Split(input, "~")
+
+	var err error
+	ma.Transport, err = parseMultiserverTransport(parts[0])
+	if err != nil {
+		return MultiserverAddress{}, err
+	}
+
+	for _, p := range parts[1:] {
+		t, err := parseMultiserverTransform(p)
+		if err != nil {
+			return MultiserverAddress{}, err
+		}
+		ma.Transforms = append(ma.Transforms, t)
+	}
+
+	return ma, nil
+}
+
+func parseMultiserverTransport(part string) (MultiserverTransport, error) {
+	var t MultiserverTransport
+
+	colon := strings.Index(part, ":")
+	if colon < 1 {
+		return t, fmt.Errorf("transport without arguments: %q: %w", part, ErrInvalidMultiserverAddress)
+	}
+	t.Name = part[:colon]
+	args := part[colon+1:]
+
+	switch t.Name {
+	case "net", "onion":
+		// the host might contain colons itself (IPv6)
+		portIdx := strings.LastIndex(args, ":")
+		if portIdx < 1 {
+			return t, fmt.Errorf("%s: expected host:port: %q: %w", t.Name, args, ErrInvalidMultiserverAddress)
+		}
+		t.Host = args[:portIdx]
+
+		var err error
+		t.Port, err = parseMultiserverPort(args[portIdx+1:])
+		if err != nil {
+			return t, err
+		}
+
+		if t.Name == "onion" && !strings.HasSuffix(t.Host, ".onion") {
+			return t, fmt.Errorf("onion: not an onion host: %q: %w", t.Host, ErrInvalidMultiserverAddress)
+		}
+
+	case "ws", "wss":
+		u, err := url.Parse(part)
+		if err != nil || u.Host == "" || u.Opaque != "" {
+			return t, fmt.Errorf("%s: expected %s://host[:port][/path]: %q: %w", t.Name, t.Name, part, ErrInvalidMultiserverAddress)
+		}
+		t.Host = u.Hostname()
+		if p := u.Port(); p != "" {
+			t.Port, err = parseMultiserverPort(p)
+			if err != nil {
+				return t, err
+			}
+		}
+		t.Path = u.EscapedPath()
+
+	case "tunnel":
+		feeds := strings.Split(args, ":")
+		if len(feeds) != 2 {
+			return t, fmt.Errorf("tunnel: expected portal:target: %q: %w", args, ErrInvalidMultiserverAddress)
+		}
+
+		var err error
+		t.Portal, err = ParseFeedRef(feeds[0])
+		if err != nil {
+			return t, fmt.Errorf("tunnel: invalid portal: %s: %w", err, ErrInvalidMultiserverAddress)
+		}
+		t.Target, err = ParseFeedRef(feeds[1])
+		if err != nil {
+			return t, fmt.Errorf("tunnel: invalid target: %s: %w", err, ErrInvalidMultiserverAddress)
+		}
+
+	default:
+		return t, fmt.Errorf("unknown transport: %q: %w", t.Name, ErrInvalidMultiserverAddress)
+	}
+
+	if t.Name != "tunnel" && t.Host == "" {
+		return t, fmt.Errorf("%s: empty host: %w", t.Name, ErrInvalidMultiserverAddress)
+	}
+
+	return t, nil
+}
+
+func parseMultiserverPort(s string) (int, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port: %q: %w", s, ErrInvalidMultiserverAddress)
+	}
+	return int(port), nil
+}
+
+func parseMultiserverTransform(part string) (MultiserverTransform, error) {
+	args := strings.Split(part, ":")
+
+	t := MultiserverTransform{Name: args[0]}
+	args = args[1:]
+
+	switch t.Name {
+	case "noauth":
+		if len(args) != 0 {
+			return t, fmt.Errorf("noauth takes no arguments: %q: %w", part, ErrInvalidMultiserverAddress)
+		}
+
+	case "shs":
+		if len(args) < 1 || len(args) > 2 {
+			return t, fmt.Errorf("shs: expected key[:seed]: %q: %w", part, ErrInvalidMultiserverAddress)
+		}
+
+		var err error
+		t.Key, err = decodeMultiserverKey(args[0])
+		if err != nil {
+			return t, fmt.Errorf("shs: invalid key: %w", err)
+		}
+
+		if len(args) == 2 {
+			t.Seed, err = decodeMultiserverKey(args[1])
+			if err != nil {
+				return t, fmt.Errorf("shs: invalid seed: %w", err)
+			}
+		}
+
+	default:
+		return t, fmt.Errorf("unknown transform: %q: %w", t.Name, ErrInvalidMultiserverAddress)
+	}
+
+	return t, nil
+}
+
+func decodeMultiserverKey(s string) ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrInvalidMultiserverAddress)
+	}
+	if n := len(k); n != 32 {
+		return nil, fmt.Errorf("wrong length %d: %w", n, ErrInvalidMultiserverAddress)
+	}
+	return k, nil
+}
+
+// String returns the address in multiserver notation.
+func (ma MultiserverAddress) String() string {
+	var sb strings.Builder
+	sb.WriteString(ma.Transport.String())
+	for _, t := range ma.Transforms {
+		sb.WriteString("~")
+		sb.WriteString(t.String())
+	}
+	return sb.String()
+}
+
+func (t MultiserverTransport) String() string {
+	switch t.Name {
+	case "ws", "wss":
+		host := t.Host
+		if t.Port != 0 {
+			host = net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return t.Name + "://" + host + t.Path
+	case "tunnel":
+		return "tunnel:" + t.Portal.Sigil() + ":" + t.Target.Sigil()
+	default:
+		return fmt.Sprintf("%s:%s:%d", t.Name, t.Host, t.Port)
+	}
+}
+
+func (t MultiserverTransform) String() string {
+	if t.Name != "shs" {
+		return t.Name
+	}
+	s := "shs:" + base64.StdEncoding.EncodeToString(t.Key)
+	if len(t.Seed) > 0 {
+		s += ":" + base64.StdEncoding.EncodeToString(t.Seed)
+	}
+	return s
+}
+
+// Feed returns the feed reference of the first shs key of the address and true,
+// or false if the address doesn't use secret-handshake.
+func (ma MultiserverAddress) Feed() (FeedRef, bool) {
+	for _, t := range ma.Transforms {
+		if t.Name != "shs" {
+			continue
+		}
+		fr, err := NewFeedRefFromBytes(t.Key, RefAlgoFeedSSB1)
+		if err != nil {
+			return FeedRef{}, false
+		}
+		return fr, true
+	}
+	return FeedRef{}, false
+}
+
+// HostPort returns host:port of the transport, useful for net.Dial.
+// It returns an empty string for tunnels.
+func (ma MultiserverAddress) HostPort() string {
+	if ma.Transport.Name == "tunnel" {
+		return ""
+	}
+	port := ma.Transport.Port
+	if port == 0 {
+		switch ma.Transport.Name {
+		case "ws":
+			port = 80
+		case "wss":
+			port = 443
+		}
+	}
+	return net.JoinHostPort(ma.Transport.Host, strconv.Itoa(port))
+}
+
+var (
+	_ encoding.TextMarshaler   = (*MultiserverAddress)(nil)
+	_ encoding.TextUnmarshaler = (*MultiserverAddress)(nil)
+)
+
+// MarshalText implements encoding.TextMarshaler
+func (ma MultiserverAddress) MarshalText() ([]byte, error) {
+	return []byte(ma.String()), nil
+}
+
+// UnmarshalText uses ParseMultiserverAddress
+func (ma *MultiserverAddress) UnmarshalText(input []byte) error {
+	newAddr, err := ParseMultiserverAddress(string(input))
+	if err != nil {
+		return err
+	}
+	*ma = newAddr
+	return nil
+}
+
+// MultiserverAddresses is a list of addresses for the same peer, separated by semicolons.
+type MultiserverAddresses []MultiserverAddress
+
+// ParseMultiserverAddresses parses a semicolon separated list of addresses.
+func ParseMultiserverAddresses(input string) (MultiserverAddresses, error) {
+	var list MultiserverAddresses
+	for i, s := range strings.Split(input, ";") {
+		addr, err := ParseMultiserverAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("address %d: %w", i, err)
+		}
+		list = append(list, addr)
+	}
+	return list, nil
+}
+
+func (mas MultiserverAddresses) String() string {
+	s := make([]string, len(mas))
+	for i, a := range mas {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ";")
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (mas MultiserverAddresses) MarshalText() ([]byte, error) {
+	return []byte(mas.String()), nil
+}
+
+// UnmarshalText uses ParseMultiserverAddresses
+func (mas *MultiserverAddresses) UnmarshalText(input []byte) error {
+	newList, err := ParseMultiserverAddresses(string(input))
+	if err != nil {
+		return err
+	}
+	*mas = newList
+	return nil
+}
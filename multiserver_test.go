@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMultiserverAddress(t *testing.T) {
+	const (
+		key  = "+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU="
+		key2 = "ye+QM09iPcDJD6YvQYjoQc7sLF/IFhmNbEqgdzQo3lQ="
+	)
+
+	type tcase struct {
+		input    string
+		hostPort string
+		feed     string // empty if no shs
+	}
+
+	var cases = []tcase{
+		{"net:example.com:8008~shs:" + key, "example.com:8008", "@" + key + ".ed25519"},
+		{"net:192.168.1.2:8008~shs:" + key, "192.168.1.2:8008", "@" + key + ".ed25519"},
+		{"net:::1:8008~shs:" + key, "[::1]:8008", "@" + key + ".ed25519"},
+		{"net:localhost:8008~noauth", "localhost:8008", ""},
+		{"onion:xyz.onion:8008~shs:" + key, "xyz.onion:8008", "@" + key + ".ed25519"},
+		{"ws://example.com:8989~shs:" + key, "example.com:8989", "@" + key + ".ed25519"},
+		{"wss://example.com/ssb~shs:" + key, "example.com:443", "@" + key + ".ed25519"},
+		{"tunnel:@" + key + ".ed25519:@" + key2 + ".ed25519~shs:" + key2, "", "@" + key2 + ".ed25519"},
+		{"net:example.com:8008~shs:" + key + ":" + key2, "example.com:8008", "@" + key + ".ed25519"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			r := require.New(t)
+
+			ma, err := ParseMultiserverAddress(tc.input)
+			r.NoError(err)
+			r.Equal(tc.input, ma.String())
+			r.Equal(tc.hostPort, ma.HostPort())
+
+			fr, ok := ma.Feed()
+			if tc.feed == "" {
+				r.False(ok)
+				return
+			}
+			r.True(ok)
+			r.Equal(tc.feed, fr.Sigil())
+		})
+	}
+}
+
+func TestParseMultiserverAddressInvalid(t *testing.T) {
+	var cases = []string{
+		"",
+		"net",
+		"net:example.com",
+		"net:example.com:port",
+		"net:example.com:99999",
+		"net::8008",
+		"onion:example.com:8008",
+		"ws:example.com:8008",
+		"tunnel:@foo.ed25519",
+		"carrier-pigeon:coop:1",
+		"net:example.com:8008~shs",
+		"net:example.com:8008~shs:tooshort",
+		"net:example.com:8008~shs:+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=:nope",
+		"net:example.com:8008~noauth:extra",
+		"net:example.com:8008~unknown",
+	}
+
+	for _, input := range cases {
+		_, err := ParseMultiserverAddress(input)
+		assert.True(t, errors.Is(err, ErrInvalidMultiserverAddress), "%q: %v", input, err)
+	}
+}
+
+func TestParseMultiserverAddresses(t *testing.T) {
+	r := require.New(t)
+
+	const input = "net:10.0.0.1:8008~shs:+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=;ws://10.0.0.1:8989~shs:+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU="
+
+	list, err := ParseMultiserverAddresses(input)
+	r.NoError(err)
+	r.Len(list, 2)
+	r.Equal("net", list[0].Transport.Name)
+	r.Equal("ws", list[1].Transport.Name)
+	r.Equal(8989, list[1].Transport.Port)
+	r.Equal(input, list.String())
+
+	_, err = ParseMultiserverAddresses(input + ";")
+	r.True(errors.Is(err, ErrInvalidMultiserverAddress))
+
+	// as JSON
+	var wrapped struct {
+		Addr MultiserverAddresses `json:"addr"`
+	}
+	r.NoError(json.Unmarshal([]byte(`{"addr":"`+input+`"}`), &wrapped))
+	r.Len(wrapped.Addr, 2)
+
+	out, err := json.Marshal(wrapped)
+	r.NoError(err)
+	r.Equal(`{"addr":"`+input+`"}`, string(out))
+}
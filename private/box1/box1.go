@@ -0,0 +1,246 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+// Package box1 implements private-box, the original encryption format of private messages on ssb.
+//
+// A box is nonce(24) | one-time public key(32) | one key slot per recipient(49 each) | secretbox of the content.
+// Each slot holds the number of recipients and the message key, encrypted with the shared secret of the one-time key and the recipient.
+//
+// See https://ssbc.github.io/scuttlebutt-protocol-guide/#private-messages
+package box1
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb-refs/internal/ed2curve"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// MaxRecipients is the number of key slots a reader tries before giving up
+const MaxRecipients = 7
+
+// Suffix is appended to the base64 encoded box when it is used as content
+const Suffix = ".box"
+
+const (
+	nonceSize  = 24
+	keySize    = 32
+	headerSize = nonceSize + keySize
+
+	// number of recipients and the message key, plus the secretbox overhead
+	slotSize = 1 + keySize + secretbox.Overhead
+)
+
+// Common errors
+var (
+	ErrNoRecipients       = errors.New("box1: no recipients")
+	ErrTooManyRecipients  = fmt.Errorf("box1: more than %d recipients", MaxRecipients)
+	ErrInvalidRecipient   = errors.New("box1: recipient is not a classic feed")
+	ErrNotBoxed           = errors.New("box1: not a boxed message")
+	ErrCouldNotDecrypt    = errors.New("box1: could not decrypt")
+	ErrInvalidCiphertext  = errors.New("box1: ciphertext too short")
+	errUnexpectedSlotData = errors.New("box1: unexpected key slot data")
+)
+
+// Encrypt boxes the plaintext for the recipients, which need to be classic (ed25519) feeds.
+func Encrypt(plaintext []byte, recps ...refs.FeedRef) ([]byte, error) {
+	return encrypt(rand.Reader, plaintext, recps)
+}
+
+func encrypt(r io.Reader, plaintext []byte, recps []refs.FeedRef) ([]byte, error) {
+	if len(recps) == 0 {
+		return nil, ErrNoRecipients
+	}
+	if len(recps) > MaxRecipients {
+		return nil, ErrTooManyRecipients
+	}
+
+	var (
+		nonce      [nonceSize]byte
+		msgKey     [keySize]byte
+		oneTimeSec [keySize]byte
+	)
+	for _, buf := range [][]byte{nonce[:], msgKey[:], oneTimeSec[:]} {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("box1: failed to read randomness: %w", err)
+		}
+	}
+
+	oneTimePub, err := curve25519.X25519(oneTimeSec[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, headerSize+len(recps)*slotSize+secretbox.Overhead+len(plaintext))
+	out = append(out, nonce[:]...)
+	out = append(out, oneTimePub...)
+
+	slot := append([]byte{byte(len(recps))}, msgKey[:]...)
+	for i, recp := range recps {
+		if recp.Algo() != refs.RefAlgoFeedSSB1 {
+			return nil, fmt.Errorf("recipient %d (%s): %w", i, recp.ShortSigil(), ErrInvalidRecipient)
+		}
+
+		curvePub, err := ed2curve.PublicKey(recp.PubKey())
+		if err != nil {
+			return nil, fmt.Errorf("recipient %d (%s): %w", i, recp.ShortSigil(), err)
+		}
+
+		slotKey, err := sharedKey(oneTimeSec[:], curvePub[:])
+		if err != nil {
+			return nil, fmt.Errorf("recipient %d (%s): %w", i, recp.ShortSigil(), err)
+		}
+
+		out = secretbox.Seal(out, slot, &nonce, &slotKey)
+	}
+
+	return secretbox.Seal(out, plaintext, &nonce, &msgKey), nil
+}
+
+// Decrypt tries to open the box with the key of kp.
+// It returns ErrCouldNotDecrypt if the box was not made for that key.
+func Decrypt(ctxt []byte, kp refs.KeyPair) ([]byte, error) {
+	if len(ctxt) < headerSize+slotSize+secretbox.Overhead {
+		return nil, ErrInvalidCiphertext
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], ctxt[:nonceSize])
+	oneTimePub := ctxt[nonceSize:headerSize]
+
+	curveSec := ed2curve.PrivateKey(kp.Private)
+	slotKey, err := sharedKey(curveSec[:], oneTimePub)
+	if err != nil {
+		return nil, ErrCouldNotDecrypt
+	}
+
+	slots := ctxt[headerSize:]
+	for i := 0; i < MaxRecipients && len(slots) >= slotSize; i++ {
+		slot, ok := secretbox.Open(nil, slots[:slotSize], &nonce, &slotKey)
+		slots = slots[slotSize:]
+		if !ok {
+			continue
+		}
+
+		if len(slot) != 1+keySize {
+			return nil, errUnexpectedSlotData
+		}
+
+		n := int(slot[0])
+		bodyStart := headerSize + n*slotSize
+		if n == 0 || bodyStart > len(ctxt) {
+			return nil, errUnexpectedSlotData
+		}
+
+		var msgKey [keySize]byte
+		copy(msgKey[:], slot[1:])
+
+		plain, ok := secretbox.Open(nil, ctxt[bodyStart:], &nonce, &msgKey)
+		if !ok {
+			return nil, ErrCouldNotDecrypt
+		}
+		return plain, nil
+	}
+
+	return nil, ErrCouldNotDecrypt
+}
+
+// sharedKey is the raw scalar multiplication, private-box uses it directly as the key of the slot
+func sharedKey(sec, pub []byte) ([keySize]byte, error) {
+	var key [keySize]byte
+	shared, err := curve25519.X25519(sec, pub)
+	if err != nil {
+		return key, err
+	}
+	copy(key[:], shared)
+	return key, nil
+}
+
+// Encode returns the box as it is used as content: base64 with the .box suffix
+func Encode(ctxt []byte) string {
+	return base64.StdEncoding.EncodeToString(ctxt) + Suffix
+}
+
+// Decode strips the .box suffix and decodes the base64 data
+func Decode(content string) ([]byte, error) {
+	if !strings.HasSuffix(content, Suffix) {
+		return nil, ErrNotBoxed
+	}
+
+	ctxt, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(content, Suffix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid base64: %s", ErrNotBoxed, err)
+	}
+	return ctxt, nil
+}
+
+// IsBoxed returns true if the content is a JSON string with the .box suffix
+func IsBoxed(content json.RawMessage) bool {
+	var s string
+	if err := json.Unmarshal(content, &s); err != nil {
+		return false
+	}
+	return strings.HasSuffix(s, Suffix)
+}
+
+// EncryptPost encrypts the post for the feeds in its Recps field and returns the content that should be published
+func EncryptPost(p refs.Post) (json.RawMessage, error) {
+	recps := make([]refs.FeedRef, len(p.Recps))
+	for i, r := range p.Recps {
+		feed, ok := r.IsFeed()
+		if !ok {
+			return nil, fmt.Errorf("recps %d: %w", i, ErrInvalidRecipient)
+		}
+		recps[i] = feed
+	}
+
+	return EncryptContent(p, recps...)
+}
+
+// EncryptContent marshals the content as JSON, encrypts it for the recipients and returns it as a JSON string
+func EncryptContent(content interface{}, recps ...refs.FeedRef) (json.RawMessage, error) {
+	plain, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("box1: failed to marshal content: %w", err)
+	}
+
+	ctxt, err := Encrypt(plain, recps...)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Encode(ctxt))
+}
+
+// DecryptContent opens boxed content, like Value.Content, and returns the JSON that was encrypted
+func DecryptContent(content json.RawMessage, kp refs.KeyPair) (json.RawMessage, error) {
+	var boxed string
+	if err := json.Unmarshal(content, &boxed); err != nil {
+		return nil, ErrNotBoxed
+	}
+
+	ctxt, err := Decode(boxed)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := Decrypt(ctxt, kp)
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(plain) {
+		return nil, fmt.Errorf("box1: decrypted content is not JSON")
+	}
+	return bytes.TrimSpace(plain), nil
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package box1
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/secretbox"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+func newTestKeyPairs(t *testing.T, n int) []refs.KeyPair {
+	kps := make([]refs.KeyPair, n)
+	for i := range kps {
+		var err error
+		kps[i], err = refs.NewKeyPair(bytes.NewReader(bytes.Repeat([]byte{byte(i)}, 64)))
+		require.NoError(t, err)
+	}
+	return kps
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	r := require.New(t)
+
+	kps := newTestKeyPairs(t, MaxRecipients+2)
+	outsider := kps[MaxRecipients+1]
+
+	for n := 1; n <= MaxRecipients; n++ {
+		recps := make([]refs.FeedRef, n)
+		for i := range recps {
+			recps[i] = kps[i].Feed
+		}
+
+		plain := []byte(`{"type":"post","text":"psst"}`)
+		ctxt, err := Encrypt(plain, recps...)
+		r.NoError(err)
+		r.Len(ctxt, headerSize+n*slotSize+secretbox.Overhead+len(plain))
+
+		for i := 0; i < n; i++ {
+			got, err := Decrypt(ctxt, kps[i])
+			r.NoError(err, "recipient %d of %d", i, n)
+			r.Equal(plain, got)
+		}
+
+		_, err = Decrypt(ctxt, outsider)
+		r.True(errors.Is(err, ErrCouldNotDecrypt))
+
+		// tampering with the body
+		ctxt[len(ctxt)-1] ^= 1
+		_, err = Decrypt(ctxt, kps[0])
+		r.True(errors.Is(err, ErrCouldNotDecrypt))
+	}
+
+	recps := make([]refs.FeedRef, MaxRecipients+1)
+	for i := range recps {
+		recps[i] = kps[i].Feed
+	}
+	_, err := Encrypt([]byte("too many"), recps...)
+	r.True(errors.Is(err, ErrTooManyRecipients))
+
+	_, err = Encrypt([]byte("nobody"))
+	r.True(errors.Is(err, ErrNoRecipients))
+
+	bendy, err := refs.NewFeedRefFromBytes(kps[0].Feed.PubKey(), refs.RefAlgoFeedBendyButt)
+	r.NoError(err)
+	_, err = Encrypt([]byte("meta"), bendy)
+	r.True(errors.Is(err, ErrInvalidRecipient))
+
+	_, err = Decrypt([]byte("short"), kps[0])
+	r.True(errors.Is(err, ErrInvalidCiphertext))
+}
+
+func TestEncryptPost(t *testing.T) {
+	r := require.New(t)
+
+	kps := newTestKeyPairs(t, 3)
+	alice, bob, claire := kps[0], kps[1], kps[2]
+
+	post := refs.NewPost("hello bob")
+	post.Recps = []refs.AnyRef{refs.NewAnyRef(alice.Feed), refs.NewAnyRef(bob.Feed)}
+
+	content, err := EncryptPost(post)
+	r.NoError(err)
+	r.True(IsBoxed(content))
+
+	var v refs.Value
+	v.Content = content
+	decoded, err := refs.DecodeContent(v)
+	r.NoError(err)
+	r.IsType(refs.PrivateContent{}, decoded)
+
+	for _, kp := range []refs.KeyPair{alice, bob} {
+		plain, err := DecryptContent(v.Content, kp)
+		r.NoError(err)
+
+		var got refs.Post
+		r.NoError(json.Unmarshal(plain, &got))
+		r.Equal("hello bob", got.Text)
+		r.Len(got.Recps, 2)
+		r.Equal(bob.Feed.Sigil(), got.Recps[1].Sigil())
+	}
+
+	_, err = DecryptContent(v.Content, claire)
+	r.True(errors.Is(err, ErrCouldNotDecrypt))
+
+	_, err = DecryptContent(json.RawMessage(`{"type":"post"}`), alice)
+	r.True(errors.Is(err, ErrNotBoxed))
+
+	_, err = DecryptContent(json.RawMessage(`"not*base64.box"`), alice)
+	r.True(errors.Is(err, ErrNotBoxed))
+
+	r.False(IsBoxed(json.RawMessage(`"plain string"`)))
+
+	var msg refs.MessageRef
+	post.Recps = append(post.Recps, refs.NewAnyRef(msg))
+	_, err = EncryptPost(post)
+	r.True(errors.Is(err, ErrInvalidRecipient))
+}
+
+// TestDecryptKnownBox opens a box that was not sealed by this package.
+// It was made with libsodium, which the javascript private-box uses as well, following the multibox format of private-box
+// with a fixed nonce, message key and one-time key instead of random ones.
+func TestDecryptKnownBox(t *testing.T) {
+	r := require.New(t)
+
+	const (
+		content = `"AAECAwQFBgcICQoLDA0ODxAREhMUFRYXE75P6uryBMf9M1j8nAByGIHRdCeBKCJ+xnTzf3/pe21IH4jXYseYnaPt92Zg63zu41EkzDh+8OCIi5oBHv/hO2G4SDWScTg2rEIZCbOoukPTvlZMEhLNJ3tz6mCdGQAr5a+txXOVD0aE2ew+RwZuixoTvU+az+BNdZh2IkSQVTpDZkjWzl4wJRg6MqcOhF0C38IeDKGGFezHLsjiEzBzRFPmtVeif/mrAClNlGe+uvn2eEutoIND2XlulS/4H3wdEx1xvtHZfoabX1+86OXGtsmInRQl8gs63SD19RpLqlxR8uYYka0fYTvNQIieUPD8bXkEFm0WJnDftJi01WMe+u+rKgqHpuQUSgieYGS7v366ndBXK/0iitRPyE3XQ16cCBLLgzM6HYY00gzhdEXf1MGgtbORVs5u+b0c.box"`
+		plain   = `{"type":"post","text":"hello from private-box","recps":["@Q6cucUQBdi32a2jCbfvfJoKq7J8kdOykYT5CSg+6/Tw=.ed25519","@Zr5+Myx6RTMyvZ0Kf32wVfXF7xoGraZtmLOftoEMRzo=.ed25519"]}`
+	)
+
+	// the recipients are the key pairs of the seeds 0x0a... and 0x0b...
+	var recps []refs.KeyPair
+	for _, b := range []byte{0x0a, 0x0b} {
+		kp, err := refs.NewKeyPair(bytes.NewReader(bytes.Repeat([]byte{b}, 32)))
+		r.NoError(err)
+		recps = append(recps, kp)
+	}
+	r.Equal("@Q6cucUQBdi32a2jCbfvfJoKq7J8kdOykYT5CSg+6/Tw=.ed25519", recps[0].Feed.Sigil())
+	r.Equal("@Zr5+Myx6RTMyvZ0Kf32wVfXF7xoGraZtmLOftoEMRzo=.ed25519", recps[1].Feed.Sigil())
+
+	for i, kp := range recps {
+		got, err := DecryptContent(json.RawMessage(content), kp)
+		r.NoError(err, "recipient %d", i)
+		r.Equal(plain, string(got), "recipient %d", i)
+
+		var p refs.Post
+		r.NoError(json.Unmarshal(got, &p))
+		r.Len(p.Recps, 2)
+	}
+
+	outsider := newTestKeyPairs(t, 1)[0]
+	_, err := DecryptContent(json.RawMessage(content), outsider)
+	r.True(errors.Is(err, ErrCouldNotDecrypt))
+}
@@ -0,0 +1,283 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+// Package box2 implements the envelope encryption format of ssb, used for direct messages and private groups.
+//
+// A box is the boxed header(32) | one key slot per recipient(32 each) | the boxed body.
+// All keys are derived from a random message key, with the author and the previous message of the feed mixed in,
+// so that a box can't be replayed on another feed or at another position.
+//
+// See https://github.com/ssbc/envelope-spec
+package box2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb-refs/tfk"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// MaxSlots is the most recipients a box can have. Readers try that many key slots.
+const MaxSlots = 16
+
+// Suffix is appended to the base64 encoded box when it is used as content
+const Suffix = ".box2"
+
+const (
+	headerSize      = 16
+	boxedHeaderSize = headerSize + secretbox.Overhead
+)
+
+// Common errors
+var (
+	ErrNoRecipients      = errors.New("box2: no recipients")
+	ErrTooManyRecipients = fmt.Errorf("box2: more than %d recipients", MaxSlots)
+	ErrNotBoxed          = errors.New("box2: not a boxed message")
+	ErrCouldNotDecrypt   = errors.New("box2: could not decrypt")
+	ErrInvalidCiphertext = errors.New("box2: invalid ciphertext")
+)
+
+// all boxes use a zero nonce, since every key is only used once
+var zeroNonce [24]byte
+
+// keyDerivation derives keys in the context of a message: hkdf.expand(key, slp(["envelope", feed_tfk, prev_tfk, ...labels]))
+type keyDerivation struct {
+	feed, prev []byte
+}
+
+func newKeyDerivation(author refs.FeedRef, previous *refs.MessageRef) (keyDerivation, error) {
+	feed, err := tfk.Encode(author)
+	if err != nil {
+		return keyDerivation{}, fmt.Errorf("box2: author: %w", err)
+	}
+
+	var prev []byte
+	if previous == nil {
+		// the first message of a feed has no previous, a sha256 message with zero bytes is used instead
+		prev = make([]byte, 2+sha256.Size)
+		prev[0] = tfk.TypeMessage
+		prev[1] = tfk.FormatMessageSHA256
+	} else {
+		prev, err = tfk.Encode(*previous)
+		if err != nil {
+			return keyDerivation{}, fmt.Errorf("box2: previous: %w", err)
+		}
+	}
+
+	return keyDerivation{feed: feed, prev: prev}, nil
+}
+
+func (kd keyDerivation) derive(key []byte, labels ...string) [KeySize]byte {
+	parts := [][]byte{[]byte("envelope"), kd.feed, kd.prev}
+	for _, l := range labels {
+		parts = append(parts, []byte(l))
+	}
+
+	var out [KeySize]byte
+	_, err := io.ReadFull(hkdf.Expand(sha256.New, key, encodeSLP(parts...)), out[:])
+	if err != nil {
+		// can only happen if more than 255*32 bytes are read
+		panic(err)
+	}
+	return out
+}
+
+// slotMask is XORed with the message key to get the key slot for a recipient
+func (kd keyDerivation) slotMask(sk SlotKey) [KeySize]byte {
+	return kd.derive(sk.Key[:], "slot_key", sk.Scheme)
+}
+
+// Encrypt boxes the plaintext for the recipients.
+// author and previous are the feed and the previous message of the message that will hold the box.
+func Encrypt(plaintext []byte, author refs.FeedRef, previous *refs.MessageRef, recps ...SlotKey) ([]byte, error) {
+	return encrypt(rand.Reader, plaintext, author, previous, recps)
+}
+
+func encrypt(r io.Reader, plaintext []byte, author refs.FeedRef, previous *refs.MessageRef, recps []SlotKey) ([]byte, error) {
+	if len(recps) == 0 {
+		return nil, ErrNoRecipients
+	}
+	if len(recps) > MaxSlots {
+		return nil, ErrTooManyRecipients
+	}
+
+	kd, err := newKeyDerivation(author, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgKey [KeySize]byte
+	if _, err := io.ReadFull(r, msgKey[:]); err != nil {
+		return nil, fmt.Errorf("box2: failed to read message key: %w", err)
+	}
+
+	readKey := kd.derive(msgKey[:], "read_key")
+	headerKey := kd.derive(readKey[:], "header_key")
+	bodyKey := kd.derive(readKey[:], "body_key")
+
+	offset := boxedHeaderSize + len(recps)*KeySize
+
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint16(header[:2], uint16(offset))
+
+	out := make([]byte, 0, offset+secretbox.Overhead+len(plaintext))
+	out = secretbox.Seal(out, header[:], &zeroNonce, &headerKey)
+
+	for _, recp := range recps {
+		mask := kd.slotMask(recp)
+		for i := range mask {
+			mask[i] ^= msgKey[i]
+		}
+		out = append(out, mask[:]...)
+	}
+
+	return secretbox.Seal(out, plaintext, &zeroNonce, &bodyKey), nil
+}
+
+// Decrypt tries to open the box with each of the keys.
+// It returns ErrCouldNotDecrypt if none of them fit.
+func Decrypt(ctxt []byte, author refs.FeedRef, previous *refs.MessageRef, keys ...SlotKey) ([]byte, error) {
+	plain, _, err := decrypt(ctxt, author, previous, keys)
+	return plain, err
+}
+
+// decrypt also returns the read key, from which the keys of header and body are derived
+func decrypt(ctxt []byte, author refs.FeedRef, previous *refs.MessageRef, keys []SlotKey) ([]byte, [KeySize]byte, error) {
+	var readKey [KeySize]byte
+
+	if len(ctxt) < boxedHeaderSize+KeySize+secretbox.Overhead {
+		return nil, readKey, ErrInvalidCiphertext
+	}
+
+	kd, err := newKeyDerivation(author, previous)
+	if err != nil {
+		return nil, readKey, err
+	}
+
+	slots := ctxt[boxedHeaderSize:]
+
+	for _, key := range keys {
+		mask := kd.slotMask(key)
+
+		for i := 0; i < MaxSlots && len(slots) >= (i+1)*KeySize; i++ {
+			var msgKey [KeySize]byte
+			slot := slots[i*KeySize : (i+1)*KeySize]
+			for j := range msgKey {
+				msgKey[j] = slot[j] ^ mask[j]
+			}
+
+			readKey = kd.derive(msgKey[:], "read_key")
+			plain, err := openWithReadKey(ctxt, kd, readKey)
+			if err == ErrCouldNotDecrypt {
+				continue
+			}
+			return plain, readKey, err
+		}
+	}
+
+	return nil, [KeySize]byte{}, ErrCouldNotDecrypt
+}
+
+// openWithReadKey opens the header to find the body and then opens that
+func openWithReadKey(ctxt []byte, kd keyDerivation, readKey [KeySize]byte) ([]byte, error) {
+	headerKey := kd.derive(readKey[:], "header_key")
+
+	header, ok := secretbox.Open(nil, ctxt[:boxedHeaderSize], &zeroNonce, &headerKey)
+	if !ok {
+		return nil, ErrCouldNotDecrypt
+	}
+
+	offset := int(binary.LittleEndian.Uint16(header[:2]))
+	if offset < boxedHeaderSize+KeySize || offset > len(ctxt)-secretbox.Overhead {
+		return nil, fmt.Errorf("%w: body offset %d out of range", ErrInvalidCiphertext, offset)
+	}
+
+	bodyKey := kd.derive(readKey[:], "body_key")
+	plain, ok := secretbox.Open(nil, ctxt[offset:], &zeroNonce, &bodyKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: header opened but body did not", ErrInvalidCiphertext)
+	}
+	return plain, nil
+}
+
+// Encode returns the box as it is used as content: base64 with the .box2 suffix
+func Encode(ctxt []byte) string {
+	return base64.StdEncoding.EncodeToString(ctxt) + Suffix
+}
+
+// Decode strips the .box2 suffix and decodes the base64 data
+func Decode(content string) ([]byte, error) {
+	if !strings.HasSuffix(content, Suffix) {
+		return nil, ErrNotBoxed
+	}
+
+	ctxt, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(content, Suffix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid base64: %s", ErrNotBoxed, err)
+	}
+	return ctxt, nil
+}
+
+// IsBoxed returns true if the content is a JSON string with the .box2 suffix
+func IsBoxed(content json.RawMessage) bool {
+	var s string
+	if err := json.Unmarshal(content, &s); err != nil {
+		return false
+	}
+	return strings.HasSuffix(s, Suffix)
+}
+
+// EncryptContent marshals the content as JSON, encrypts it and returns it as a JSON string.
+// author and previous are the feed and the previous message of the message that will hold the content.
+func EncryptContent(content interface{}, author refs.FeedRef, previous *refs.MessageRef, recps ...SlotKey) (json.RawMessage, error) {
+	plain, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("box2: failed to marshal content: %w", err)
+	}
+
+	ctxt, err := Encrypt(plain, author, previous, recps...)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Encode(ctxt))
+}
+
+// DecryptValue opens the boxed content of the message with one of the keys and replaces it with the decrypted JSON.
+func DecryptValue(v *refs.Value, keys ...SlotKey) error {
+	var boxed string
+	if err := json.Unmarshal(v.Content, &boxed); err != nil {
+		return ErrNotBoxed
+	}
+
+	ctxt, err := Decode(boxed)
+	if err != nil {
+		return err
+	}
+
+	plain, err := Decrypt(ctxt, v.Author, v.Previous, keys...)
+	if err != nil {
+		return err
+	}
+
+	// the body might be padded with zeros
+	plain = bytes.TrimRight(plain, "\x00")
+	if !json.Valid(plain) {
+		return fmt.Errorf("box2: decrypted content is not JSON")
+	}
+
+	v.Content = plain
+	return nil
+}
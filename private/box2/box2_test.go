@@ -0,0 +1,385 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package box2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/secretbox"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+func newTestKeyPair(t *testing.T, b byte) refs.KeyPair {
+	kp, err := refs.NewKeyPair(bytes.NewReader(bytes.Repeat([]byte{b}, 64)))
+	require.NoError(t, err)
+	return kp
+}
+
+func newTestMessageRef(t *testing.T, b byte) refs.MessageRef {
+	mr, err := refs.NewMessageRefFromBytes(bytes.Repeat([]byte{b}, 32), refs.RefAlgoMessageSSB1)
+	require.NoError(t, err)
+	return mr
+}
+
+func TestEncodeSLP(t *testing.T) {
+	got := encodeSLP([]byte("envelope"), []byte{}, bytes.Repeat([]byte{1}, 300))
+	require.Equal(t, "0800656e76656c6f7065"+"0000"+"2c01", hex.EncodeToString(got[:14]))
+	require.Len(t, got, 2+8+2+2+300)
+}
+
+// the expected keys of the known-answer tests below were computed with a separate implementation of the spec (node's crypto module),
+// so that they don't just repeat what this package does.
+
+func TestDeriveSecretKnownAnswers(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestKeyPair(t, 1)
+	prev := newTestMessageRef(t, 2)
+
+	kd, err := newKeyDerivation(alice.Feed, &prev)
+	r.NoError(err)
+
+	msgKey := bytes.Repeat([]byte{3}, KeySize)
+	readKey := kd.derive(msgKey, "read_key")
+	r.Equal("daa42339c8023c90868240eab2a3ad0db27a3865bff2912f6373979f8dacd63a", hex.EncodeToString(readKey[:]))
+	headerKey := kd.derive(readKey[:], "header_key")
+	r.Equal("700d11d39794dc00f133eccedc0b40d8cc5ef5d894b34ec40188b08edfe01bf7", hex.EncodeToString(headerKey[:]))
+	bodyKey := kd.derive(readKey[:], "body_key")
+	r.Equal("796c0e51b91df49654034a10dc8b53adcf2c95b5f74c2871e12e8d3a4ec20af0", hex.EncodeToString(bodyKey[:]))
+
+	var groupKey SlotKey
+	groupKey.Scheme = SchemeLargeSymmetricGroup
+	copy(groupKey.Key[:], bytes.Repeat([]byte{4}, KeySize))
+	mask := kd.slotMask(groupKey)
+	r.Equal("bcb0acec4400c109c4bcd9a0f98003bba7216c34b1da9d4c0981d4f585b36e66", hex.EncodeToString(mask[:]))
+
+	// a box with that message key has the masked key in its slot and opens with the keys from above
+	plain := []byte(`{"type":"test"}`)
+	ctxt, err := encrypt(bytes.NewReader(msgKey), plain, alice.Feed, &prev, []SlotKey{groupKey})
+	r.NoError(err)
+
+	header, ok := secretbox.Open(nil, ctxt[:boxedHeaderSize], &zeroNonce, &headerKey)
+	r.True(ok)
+	r.Equal(append([]byte{byte(boxedHeaderSize + KeySize), 0}, make([]byte, headerSize-2)...), header)
+
+	slot := ctxt[boxedHeaderSize : boxedHeaderSize+KeySize]
+	for i := range slot {
+		r.Equal(msgKey[i], slot[i]^mask[i], "slot byte %d", i)
+	}
+
+	body, ok := secretbox.Open(nil, ctxt[boxedHeaderSize+KeySize:], &zeroNonce, &bodyKey)
+	r.True(ok)
+	r.Equal(plain, body)
+}
+
+func TestDirectMessageKeyKnownAnswer(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestKeyPair(t, 1)
+	bob := newTestKeyPair(t, 2)
+
+	key, err := DirectMessageKey(alice, bob.Feed)
+	r.NoError(err)
+	r.Equal("124a7d156f7163a7e4d93b86075f36d89fe289d193ec518d3a349d6a8d4ece9e", hex.EncodeToString(key.Key[:]))
+}
+
+// TestEnvelopeSpecVectors runs the test vectors of the envelope-spec repository.
+// They are the files of the vectors directory of github.com/ssbc/envelope-spec, copied to testdata/envelope-spec.
+func TestEnvelopeSpecVectors(t *testing.T) {
+	runSpecVectors(t, filepath.Join("testdata", "envelope-spec"))
+}
+
+// runSpecVectors runs every vector in dir. A missing directory or a type that isn't handled fails the test,
+// so that the vectors can't silently stop running.
+func runSpecVectors(t *testing.T, dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	if len(files) == 0 {
+		t.Fatalf("no test vectors in %s", dir)
+	}
+
+	for _, f := range files {
+		f := f
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			r := require.New(t)
+
+			data, err := ioutil.ReadFile(f)
+			r.NoError(err)
+
+			var vec specVector
+			r.NoError(json.Unmarshal(data, &vec))
+
+			switch vec.Type {
+			case "derive_secret":
+				kd := vec.Input.keyDerivation(t)
+
+				// the generic form derives one secret with the passed labels
+				if len(vec.Input.Labels) > 0 {
+					got := kd.derive(vec.Input.Key, vec.Input.Labels...)
+					r.Equal(vec.Output.DerivedSecret, got[:], vec.Description)
+					return
+				}
+
+				readKey := kd.derive(vec.Input.MsgKey, "read_key")
+				r.Equal(vec.Output.ReadKey, readKey[:], vec.Description)
+				headerKey := kd.derive(readKey[:], "header_key")
+				r.Equal(vec.Output.HeaderKey, headerKey[:], vec.Description)
+				bodyKey := kd.derive(readKey[:], "body_key")
+				r.Equal(vec.Output.BodyKey, bodyKey[:], vec.Description)
+
+			case "direct_message_key":
+				me, err := refs.NewKeyPairFromPrivate(vec.Input.MySecret)
+				r.NoError(err, vec.Description)
+				key, err := DirectMessageKey(me, vec.Input.YourFeedID)
+				r.NoError(err, vec.Description)
+				r.Equal(vec.Output.SharedKey, key.Key[:], vec.Description)
+
+			case "box":
+				ctxt, err := encrypt(bytes.NewReader(vec.Input.MsgKey), vec.Input.PlainText, vec.Input.FeedID, vec.Input.PrevMsgID, vec.Input.slotKeys(t))
+				r.NoError(err, vec.Description)
+				r.Equal(vec.Output.Ciphertext, ctxt, vec.Description)
+
+			case "unbox":
+				plain, err := Decrypt(vec.Input.Ciphertext, vec.Input.FeedID, vec.Input.PrevMsgID, vec.Input.slotKeys(t)...)
+				if vec.ErrorCode != "" {
+					r.Error(err, vec.Description)
+					return
+				}
+				r.NoError(err, vec.Description)
+				r.Equal(vec.Output.PlainText, plain, vec.Description)
+
+			case "cloaked_msg_id":
+				var readKey [KeySize]byte
+				copy(readKey[:], vec.Input.ReadKey)
+				cloaked, err := CloakedMessageID(vec.Input.PublicMsgID, readKey)
+				r.NoError(err, vec.Description)
+				r.True(vec.Output.CloakedMsgID.Equal(cloaked), vec.Description)
+
+			case "group_id":
+				var groupKey SlotKey
+				groupKey.Scheme = SchemeLargeSymmetricGroup
+				copy(groupKey.Key[:], vec.Input.GroupKey)
+				groupID, err := GroupID(vec.Input.GroupInitMsg.Key, vec.Input.GroupInitMsg.Value, groupKey)
+				r.NoError(err, vec.Description)
+				r.True(vec.Output.GroupID.Equal(groupID), vec.Description)
+
+			default:
+				t.Fatalf("vector type %q is not handled", vec.Type)
+			}
+		})
+	}
+}
+
+// specVector is the layout of the envelope-spec and ssb-private-group-keys vectors. Keys and texts are base64 encoded, which []byte fields decode.
+type specVector struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	ErrorCode   string `json:"error_code"`
+
+	Input specVectorInput `json:"input"`
+
+	Output struct {
+		DerivedSecret []byte          `json:"derived_secret"`
+		ReadKey       []byte          `json:"read_key"`
+		HeaderKey     []byte          `json:"header_key"`
+		BodyKey       []byte          `json:"body_key"`
+		SharedKey     []byte          `json:"shared_key"`
+		CloakedMsgID  refs.MessageRef `json:"cloaked_msg_id"`
+		GroupID       refs.MessageRef `json:"group_id"`
+		Ciphertext    []byte          `json:"ciphertext"`
+		PlainText     []byte          `json:"plain_text"`
+	} `json:"output"`
+}
+
+type specVectorInput struct {
+	FeedID     refs.FeedRef     `json:"feed_id"`
+	PrevMsgID  *refs.MessageRef `json:"prev_msg_id"`
+	MsgKey     []byte           `json:"msg_key"`
+	PlainText  []byte           `json:"plain_text"`
+	Ciphertext []byte           `json:"ciphertext"`
+
+	Key    []byte   `json:"key"`
+	Labels []string `json:"labels"`
+
+	MySecret   []byte       `json:"my_secret"`
+	YourFeedID refs.FeedRef `json:"your_feed_id"`
+
+	PublicMsgID  refs.MessageRef `json:"public_msg_id"`
+	ReadKey      []byte          `json:"read_key"`
+	GroupKey     []byte          `json:"group_key"`
+	GroupInitMsg struct {
+		Key   refs.MessageRef `json:"key"`
+		Value refs.Value      `json:"value"`
+	} `json:"group_init_msg"`
+
+	RecpKeys  []specKey `json:"recp_keys"`
+	TrialKeys []specKey `json:"trial_keys"`
+}
+
+type specKey struct {
+	Key    []byte `json:"key"`
+	Scheme string `json:"scheme"`
+}
+
+func (in specVectorInput) keyDerivation(t *testing.T) keyDerivation {
+	kd, err := newKeyDerivation(in.FeedID, in.PrevMsgID)
+	require.NoError(t, err)
+	return kd
+}
+
+// slotKeys returns the recipient keys of box vectors or the keys to try of unbox vectors
+func (in specVectorInput) slotKeys(t *testing.T) []SlotKey {
+	keys := in.RecpKeys
+	if len(keys) == 0 {
+		keys = in.TrialKeys
+	}
+
+	sks := make([]SlotKey, len(keys))
+	for i, k := range keys {
+		require.Len(t, k.Key, KeySize, "key %d", i)
+		sks[i].Scheme = k.Scheme
+		copy(sks[i].Key[:], k.Key)
+	}
+	return sks
+}
+
+func TestGroupRoundtrip(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestKeyPair(t, 1)
+	prev := newTestMessageRef(t, 2)
+
+	var groupKeys []SlotKey
+	for i := 0; i < 4; i++ {
+		gk, err := NewGroupKey(bytes.NewReader(bytes.Repeat([]byte{byte(10 + i)}, 32)))
+		r.NoError(err)
+		groupKeys = append(groupKeys, gk)
+	}
+
+	plain := []byte(`{"type":"post","text":"hello group"}`)
+	ctxt, err := Encrypt(plain, alice.Feed, &prev, groupKeys[:3]...)
+	r.NoError(err)
+	r.Len(ctxt, boxedHeaderSize+3*KeySize+16+len(plain))
+
+	for i := 0; i < 3; i++ {
+		got, err := Decrypt(ctxt, alice.Feed, &prev, groupKeys[3], groupKeys[i])
+		r.NoError(err, "key %d", i)
+		r.Equal(plain, got)
+	}
+
+	// not a recipient
+	_, err = Decrypt(ctxt, alice.Feed, &prev, groupKeys[3])
+	r.True(errors.Is(err, ErrCouldNotDecrypt))
+
+	// the box is bound to its position on the feed
+	otherPrev := newTestMessageRef(t, 3)
+	_, err = Decrypt(ctxt, alice.Feed, &otherPrev, groupKeys[0])
+	r.True(errors.Is(err, ErrCouldNotDecrypt))
+	_, err = Decrypt(ctxt, alice.Feed, nil, groupKeys[0])
+	r.True(errors.Is(err, ErrCouldNotDecrypt))
+	bob := newTestKeyPair(t, 4)
+	_, err = Decrypt(ctxt, bob.Feed, &prev, groupKeys[0])
+	r.True(errors.Is(err, ErrCouldNotDecrypt))
+
+	// the same key with another scheme doesn't open the slot
+	wrongScheme := groupKeys[0]
+	wrongScheme.Scheme = SchemeDiffieHellmanSSBv1
+	_, err = Decrypt(ctxt, alice.Feed, &prev, wrongScheme)
+	r.True(errors.Is(err, ErrCouldNotDecrypt))
+
+	// first message of a feed
+	first, err := Encrypt(plain, alice.Feed, nil, groupKeys[0])
+	r.NoError(err)
+	got, err := Decrypt(first, alice.Feed, nil, groupKeys[0])
+	r.NoError(err)
+	r.Equal(plain, got)
+
+	// tampering with the body
+	ctxt[len(ctxt)-1] ^= 1
+	_, err = Decrypt(ctxt, alice.Feed, &prev, groupKeys[0])
+	r.True(errors.Is(err, ErrInvalidCiphertext))
+}
+
+func TestEncryptLimits(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestKeyPair(t, 1)
+
+	_, err := Encrypt([]byte("{}"), alice.Feed, nil)
+	r.True(errors.Is(err, ErrNoRecipients))
+
+	keys := make([]SlotKey, MaxSlots+1)
+	_, err = Encrypt([]byte("{}"), alice.Feed, nil, keys...)
+	r.True(errors.Is(err, ErrTooManyRecipients))
+
+	_, err = Decrypt([]byte("short"), alice.Feed, nil, keys[0])
+	r.True(errors.Is(err, ErrInvalidCiphertext))
+}
+
+func TestDirectMessages(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestKeyPair(t, 1)
+	bob := newTestKeyPair(t, 2)
+	claire := newTestKeyPair(t, 3)
+
+	aliceToBob, err := DirectMessageKey(alice, bob.Feed)
+	r.NoError(err)
+	bobToAlice, err := DirectMessageKey(bob, alice.Feed)
+	r.NoError(err)
+	r.Equal(aliceToBob, bobToAlice, "both sides need to derive the same key")
+	r.Equal(SchemeDiffieHellmanSSBv1, aliceToBob.Scheme)
+
+	claireToBob, err := DirectMessageKey(claire, bob.Feed)
+	r.NoError(err)
+	r.NotEqual(aliceToBob.Key, claireToBob.Key)
+
+	// alice writes a DM to bob, with a group key for herself
+	aliceOwn, err := NewGroupKey(nil)
+	r.NoError(err)
+
+	prev := newTestMessageRef(t, 7)
+	post := refs.NewPost("hi bob")
+	post.Recps = []refs.AnyRef{refs.NewAnyRef(bob.Feed)}
+
+	content, err := EncryptContent(post, alice.Feed, &prev, aliceToBob, aliceOwn)
+	r.NoError(err)
+	r.True(IsBoxed(content))
+
+	msg := refs.Value{
+		Previous: &prev,
+		Author:   alice.Feed,
+		Sequence: 2,
+		Content:  content,
+	}
+
+	for _, key := range []SlotKey{bobToAlice, aliceOwn} {
+		v := msg
+		r.NoError(DecryptValue(&v, key))
+
+		var got refs.Post
+		r.NoError(json.Unmarshal(v.Content, &got))
+		r.Equal("hi bob", got.Text)
+	}
+
+	v := msg
+	err = DecryptValue(&v, claireToBob)
+	r.True(errors.Is(err, ErrCouldNotDecrypt))
+	r.Equal(msg.Content, v.Content, "content should not be touched")
+
+	v.Content = json.RawMessage(`{"type":"post"}`)
+	r.True(errors.Is(DecryptValue(&v, bobToAlice), ErrNotBoxed))
+
+	v.Content = json.RawMessage(`"Zm9v.box"`)
+	r.True(errors.Is(DecryptValue(&v, bobToAlice), ErrNotBoxed))
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package box2
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb-refs/tfk"
+	"golang.org/x/crypto/hkdf"
+)
+
+// CloakedMessageID hides the ID of a message behind its read key: hkdf.expand(read_key, slp(["envelope", msg_tfk, "cloaked_msg_id"])).
+// That is derive_secret of the envelope spec, with the message ID as the context instead of feed and previous.
+// Only those that can read the message can compute it.
+// See https://github.com/ssbc/ssb-private-group-keys
+func CloakedMessageID(msg refs.MessageRef, readKey [KeySize]byte) (refs.MessageRef, error) {
+	msgTFK, err := tfk.Encode(msg)
+	if err != nil {
+		return refs.MessageRef{}, fmt.Errorf("box2/cloaked: %w", err)
+	}
+
+	info := encodeSLP([]byte("envelope"), msgTFK, []byte("cloaked_msg_id"))
+
+	var cloaked [sha256.Size]byte
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, readKey[:], info), cloaked[:]); err != nil {
+		return refs.MessageRef{}, fmt.Errorf("box2/cloaked: %w", err)
+	}
+
+	return refs.NewMessageRefFromBytes(cloaked[:], refs.RefAlgoCloakedGroup)
+}
+
+// ReadKey opens the key slots and header of the box with one of the keys and returns its read key.
+func ReadKey(ctxt []byte, author refs.FeedRef, previous *refs.MessageRef, keys ...SlotKey) ([KeySize]byte, error) {
+	_, readKey, err := decrypt(ctxt, author, previous, keys)
+	return readKey, err
+}
+
+// GroupID derives the cloaked ID of a private group from its group/init message, which is boxed with the group key.
+// initKey is the key of that message.
+func GroupID(initKey refs.MessageRef, init refs.Value, groupKey SlotKey) (refs.MessageRef, error) {
+	var boxed string
+	if err := json.Unmarshal(init.Content, &boxed); err != nil {
+		return refs.MessageRef{}, ErrNotBoxed
+	}
+
+	ctxt, err := Decode(boxed)
+	if err != nil {
+		return refs.MessageRef{}, err
+	}
+
+	plain, readKey, err := decrypt(ctxt, init.Author, init.Previous, []SlotKey{groupKey})
+	if err != nil {
+		return refs.MessageRef{}, err
+	}
+
+	var gi refs.GroupInit
+	if err := json.Unmarshal(plain, &gi); err != nil {
+		return refs.MessageRef{}, fmt.Errorf("box2/group: not a group/init message: %w", err)
+	}
+
+	return CloakedMessageID(initKey, readKey)
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package box2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb-refs/internal/ed2curve"
+	"github.com/ssbc/go-ssb-refs/tfk"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// The key schemes of the envelope spec, they are mixed into the derivation of the key slots
+const (
+	SchemeLargeSymmetricGroup = "envelope-large-symmetric-group"
+	SchemeDiffieHellmanSSBv1  = "envelope-id-based-dm-converted-ed25519"
+)
+
+// KeySize is the length of all the keys of box2
+const KeySize = 32
+
+// SlotKey is a key that a key slot can be opened with, together with its scheme
+type SlotKey struct {
+	Key    [KeySize]byte
+	Scheme string
+}
+
+// NewGroupKey returns a fresh random key for a private group. If r is nil, crypto/rand is used.
+func NewGroupKey(r io.Reader) (SlotKey, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+
+	sk := SlotKey{Scheme: SchemeLargeSymmetricGroup}
+	if _, err := io.ReadFull(r, sk.Key[:]); err != nil {
+		return SlotKey{}, fmt.Errorf("box2: failed to read group key: %w", err)
+	}
+	return sk, nil
+}
+
+var dmExtractSalt = sha256.Sum256([]byte("envelope-dm-v1-extract-salt"))
+
+// DirectMessageKey derives the key that me and other share for direct messages,
+// from the diffie-hellman keys that are converted from their ed25519 feed keys.
+// Both sides derive the same key.
+func DirectMessageKey(me refs.KeyPair, other refs.FeedRef) (SlotKey, error) {
+	myFeedTFK, err := tfk.Encode(me.Feed)
+	if err != nil {
+		return SlotKey{}, fmt.Errorf("box2/dm: own feed: %w", err)
+	}
+	otherFeedTFK, err := tfk.Encode(other)
+	if err != nil {
+		return SlotKey{}, fmt.Errorf("box2/dm: other feed: %w", err)
+	}
+
+	mySecret := ed2curve.PrivateKey(me.Private)
+	myPublic, err := ed2curve.PublicKey(me.Feed.PubKey())
+	if err != nil {
+		return SlotKey{}, fmt.Errorf("box2/dm: own feed: %w", err)
+	}
+	otherPublic, err := ed2curve.PublicKey(other.PubKey())
+	if err != nil {
+		return SlotKey{}, fmt.Errorf("box2/dm: other feed: %w", err)
+	}
+
+	shared, err := curve25519.X25519(mySecret[:], otherPublic[:])
+	if err != nil {
+		return SlotKey{}, fmt.Errorf("box2/dm: %w", err)
+	}
+
+	infoKeys := [][]byte{
+		append(encodeDHKey(myPublic), myFeedTFK...),
+		append(encodeDHKey(otherPublic), otherFeedTFK...),
+	}
+	sort.Slice(infoKeys, func(i, j int) bool {
+		return bytes.Compare(infoKeys[i], infoKeys[j]) < 0
+	})
+	info := encodeSLP([]byte("envelope-ssb-dm-v1/key"), infoKeys[0], infoKeys[1])
+
+	prk := hkdf.Extract(sha256.New, shared, dmExtractSalt[:])
+
+	sk := SlotKey{Scheme: SchemeDiffieHellmanSSBv1}
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, info), sk.Key[:]); err != nil {
+		return SlotKey{}, fmt.Errorf("box2/dm: %w", err)
+	}
+	return sk, nil
+}
+
+// encodeDHKey returns the type-format-key encoding of a curve25519 diffie-hellman key
+func encodeDHKey(pub [32]byte) []byte {
+	return append([]byte{tfk.TypeDiffieHellmanKey, 0}, pub[:]...)
+}
+
+// encodeSLP is the shallow length-prefixed encoding: every part is prefixed by its length as a little-endian uint16
+func encodeSLP(parts ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, p := range parts {
+		buf.WriteByte(byte(len(p)))
+		buf.WriteByte(byte(len(p) >> 8))
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
@@ -76,7 +76,7 @@ func ParseRef(str string) (Ref, error) {
 		if asURL.Scheme != "ssb" {
 			return nil, fmt.Errorf("expected ssb protocl scheme on URL: %q: %w", str, ErrInvalidRefType)
 		}
-		asSSBURI, err := parseCaononicalURI(asURL.Opaque)
+		asSSBURI, _, err := parseCanonicalURL(str, asURL, false)
 		return asSSBURI.ref, err
 	}
 }
@@ -394,7 +394,7 @@ func ParseFeedRef(str string) (FeedRef, error) {
 		if asURL.Scheme != "ssb" {
 			return emptyFeedRef, fmt.Errorf("expected ssb protocol scheme on URL: %q: %w", str, ErrInvalidRef)
 		}
-		asSSBURI, err := parseCaononicalURI(asURL.Opaque)
+		asSSBURI, _, err := parseCanonicalURL(str, asURL, false)
 		if err != nil {
 			return emptyFeedRef, err
 		}
@@ -576,6 +576,11 @@ type AnyRef struct {
 	channel string
 }
 
+// NewAnyRef wraps a reference, for instance to use it as a recipient of a post
+func NewAnyRef(r Ref) AnyRef {
+	return AnyRef{r: r}
+}
+
 // ShortSigil returns a truncated version of Sigil()
 func (ar AnyRef) ShortSigil() string {
 	if ar.r == nil {
@@ -650,8 +655,27 @@ func (ar AnyRef) MarshalText() ([]byte, error) {
 	return ar.r.MarshalText()
 }
 
-// UnmarshalJSON implements JSON deserialization for any supported reference type, and #channel names as well
+// UnmarshalJSON implements JSON deserialization for any supported reference type, and #channel names as well.
+// Like the recps of Patchwork, the reference can also be the link of an object: {"link": "@...", "name": "..."}.
+// The other fields of that object are dropped.
 func (ar *AnyRef) UnmarshalJSON(b []byte) error {
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		var obj struct {
+			Link json.RawMessage `json:"link"`
+		}
+		if err := json.Unmarshal(trimmed, &obj); err != nil {
+			return fmt.Errorf("ssb/anyRef: not a valid link object (%w)", err)
+		}
+		if len(obj.Link) == 0 || obj.Link[0] != '"' {
+			return fmt.Errorf("ssb/anyRef: object without string link: %w", ErrInvalidRef)
+		}
+		return ar.UnmarshalJSON(obj.Link)
+	}
+
+	if len(b) < 2 {
+		return fmt.Errorf("ssb/anyRef: too short: %d: %w", len(b), ErrInvalidRef)
+	}
+
 	if string(b[0:2]) == `"#` {
 		ar.channel = string(b[1 : len(b)-1])
 		return nil
@@ -678,9 +702,9 @@ func (ar *AnyRef) UnmarshalJSON(b []byte) error {
 		return fmt.Errorf("ssb/anyRef: parsing (%q) as URL failed: %w", refStr, err)
 	}
 
-	asURI, err := parseCaononicalURI(parsedURL.Opaque)
+	asURI, _, err := parseCanonicalURL(refStr, parsedURL, false)
 	if err != nil {
-		return fmt.Errorf("ssb/anyRef: parsing (%q) as ssb-uri failed: %w", parsedURL.Opaque, err)
+		return fmt.Errorf("ssb/anyRef: parsing (%q) as ssb-uri failed: %w", refStr, err)
 	}
 
 	ar.r = asURI.ref
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// IsValidRoomAlias returns true if the alias only uses lower case letters and numbers, as required by rooms2 servers.
+func IsValidRoomAlias(alias string) bool {
+	if alias == "" {
+		return false
+	}
+	for _, c := range alias {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// RoomAliasRegistration ties an alias of a user to a room.
+// See https://ssb-ngi-pointer.github.io/rooms2/#alias-registration
+type RoomAliasRegistration struct {
+	Alias string
+
+	RoomID FeedRef
+	UserID FeedRef
+}
+
+// Message returns the string that is signed by the user: =room-alias-registration:${roomID}:${userID}:${alias}
+func (r RoomAliasRegistration) Message() []byte {
+	var msg bytes.Buffer
+	msg.WriteString("=room-alias-registration:")
+	msg.WriteString(r.RoomID.Sigil())
+	msg.WriteString(":")
+	msg.WriteString(r.UserID.Sigil())
+	msg.WriteString(":")
+	msg.WriteString(r.Alias)
+	return msg.Bytes()
+}
+
+// Sign creates the confirmation for a registration with the private key of the user.
+func (r RoomAliasRegistration) Sign(priv ed25519.PrivateKey) (RoomAliasConfirmation, error) {
+	if !IsValidRoomAlias(r.Alias) {
+		return RoomAliasConfirmation{}, fmt.Errorf("ssb/room-alias: invalid alias: %q", r.Alias)
+	}
+
+	pub, ok := priv.Public().(ed25519.PublicKey)
+	if !ok || !bytes.Equal(pub, r.UserID.PubKey()) {
+		return RoomAliasConfirmation{}, fmt.Errorf("ssb/room-alias: private key does not belong to %s", r.UserID.ShortSigil())
+	}
+
+	return RoomAliasConfirmation{
+		RoomAliasRegistration: r,
+		Signature:             ed25519.Sign(priv, r.Message()),
+	}, nil
+}
+
+// RoomAliasConfirmation is a registration and its signature by the user.
+type RoomAliasConfirmation struct {
+	RoomAliasRegistration
+
+	Signature []byte
+}
+
+// Verify checks that the alias is valid and the signature was made by the user for the registration.
+func (c RoomAliasConfirmation) Verify() error {
+	if !IsValidRoomAlias(c.Alias) {
+		return fmt.Errorf("ssb/room-alias: invalid alias: %q", c.Alias)
+	}
+	if !ed25519.Verify(c.UserID.PubKey(), c.Message(), c.Signature) {
+		return ErrInvalidSig
+	}
+	return nil
+}
+
+// EncodeSignature returns the signature as base64 with the .sig.ed25519 suffix.
+func (c RoomAliasConfirmation) EncodeSignature() string {
+	return base64.StdEncoding.EncodeToString(c.Signature) + ".sig.ed25519"
+}
+
+// Action returns the consume-alias action for the confirmation and the multiserver address of the room.
+func (c RoomAliasConfirmation) Action(multiserverAddress MultiserverAddress) ConsumeAliasAction {
+	return ConsumeAliasAction{
+		RoomID:             c.RoomID,
+		UserID:             c.UserID,
+		Alias:              c.Alias,
+		Signature:          c.EncodeSignature(),
+		MultiserverAddress: multiserverAddress,
+	}
+}
+
+// Confirmation decodes the alias and signature of the action into a confirmation, that can be verified.
+func (a ConsumeAliasAction) Confirmation() (RoomAliasConfirmation, error) {
+	sig, err := decodeRoomAliasSignature(a.Signature)
+	if err != nil {
+		return RoomAliasConfirmation{}, err
+	}
+
+	return RoomAliasConfirmation{
+		RoomAliasRegistration: RoomAliasRegistration{
+			Alias:  a.Alias,
+			RoomID: a.RoomID,
+			UserID: a.UserID,
+		},
+		Signature: sig,
+	}, nil
+}
+
+// decodeRoomAliasSignature accepts standard and URL-safe base64, with or without the .sig.ed25519 suffix
+func decodeRoomAliasSignature(s string) ([]byte, error) {
+	s = strings.TrimSuffix(s, ".sig.ed25519")
+
+	sig, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		sig, err = base64.URLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("ssb/room-alias: signature is not base64: %w", ErrInvalidSig)
+		}
+	}
+
+	if n := len(sig); n != ed25519.SignatureSize {
+		return nil, fmt.Errorf("ssb/room-alias: signature has wrong length %d: %w", n, ErrInvalidSig)
+	}
+	return sig, nil
+}
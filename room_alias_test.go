@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestRoomAliasRegistration(t *testing.T) {
+	r := require.New(t)
+
+	userPub, userPriv, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte("u"), 64)))
+	r.NoError(err)
+	roomPub, roomPriv, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte("r"), 64)))
+	r.NoError(err)
+
+	userID, err := NewFeedRefFromBytes(userPub, RefAlgoFeedSSB1)
+	r.NoError(err)
+	roomID, err := NewFeedRefFromBytes(roomPub, RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	reg := RoomAliasRegistration{Alias: "bob", RoomID: roomID, UserID: userID}
+	r.Equal("=room-alias-registration:"+roomID.Sigil()+":"+userID.Sigil()+":bob", string(reg.Message()))
+
+	_, err = reg.Sign(roomPriv)
+	r.Error(err, "should only be signed by the user")
+
+	invalid := reg
+	invalid.Alias = "Not Valid"
+	_, err = invalid.Sign(userPriv)
+	r.Error(err)
+
+	confirmation, err := reg.Sign(userPriv)
+	r.NoError(err)
+	r.NoError(confirmation.Verify())
+
+	// through an URI and back
+	msaddr, err := NewNetMultiserverAddress("room.example:8008", roomID.PubKey())
+	r.NoError(err)
+	uri := confirmation.Action(msaddr).String()
+
+	action, err := ParseExperimentalAction(uri)
+	r.NoError(err)
+	consume, ok := action.(ConsumeAliasAction)
+	r.True(ok)
+
+	got, err := consume.Confirmation()
+	r.NoError(err)
+	r.Equal(confirmation, got)
+	r.NoError(got.Verify())
+
+	// tampering
+	got.Alias = "alice"
+	r.True(errors.Is(got.Verify(), ErrInvalidSig))
+
+	consume.Signature = "tooshort"
+	_, err = consume.Confirmation()
+	r.True(errors.Is(err, ErrInvalidSig))
+}
+
+func TestIsValidRoomAlias(t *testing.T) {
+	r := require.New(t)
+	r.True(IsValidRoomAlias("bob"))
+	r.True(IsValidRoomAlias("bob2000"))
+	r.False(IsValidRoomAlias(""))
+	r.False(IsValidRoomAlias("Bob"))
+	r.False(IsValidRoomAlias("bob-the-builder"))
+	r.False(IsValidRoomAlias("böb"))
+}
+
+// TestRoomAliasSpecURI checks that both ways of building a consume-alias URI use the parameter names of the ssb-uri-spec
+func TestRoomAliasSpecURI(t *testing.T) {
+	r := require.New(t)
+
+	const want = "ssb:experimental?action=consume-alias&alias=bob" +
+		"&multiserverAddress=net%3Aroom.example%3A8008~shs%3A%2BoaWWDs8g73EZFUMfW37R%2FULtFEjwKN%2FDczvdYihjbU%3D" +
+		"&roomId=%40%2BoaWWDs8g73EZFUMfW37R%2FULtFEjwKN%2FDczvdYihjbU%3D.ed25519" +
+		"&signature=c2lnbmF0dXJl.sig.ed25519" +
+		"&userId=%40ye%2BQM09iPcDJD6YvQYjoQc7sLF%2FIFhmNbEqgdzQo3lQ%3D.ed25519"
+
+	roomID, err := ParseFeedRef("@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519")
+	r.NoError(err)
+	userID, err := ParseFeedRef("@ye+QM09iPcDJD6YvQYjoQc7sLF/IFhmNbEqgdzQo3lQ=.ed25519")
+	r.NoError(err)
+
+	built, err := NewExperimentalURI(
+		MSAddr("room.example:8008", roomID.PubKey()),
+		RoomAlias(roomID.String(), userID.String(), "bob", "c2lnbmF0dXJl.sig.ed25519"),
+	)
+	r.NoError(err)
+	r.Equal(want, built.String())
+
+	msaddr, err := NewNetMultiserverAddress("room.example:8008", roomID.PubKey())
+	r.NoError(err)
+	action := ConsumeAliasAction{
+		RoomID:             roomID,
+		UserID:             userID,
+		Alias:              "bob",
+		Signature:          "c2lnbmF0dXJl.sig.ed25519",
+		MultiserverAddress: msaddr,
+	}
+	r.Equal(want, action.String())
+
+	parsed, err := ParseExperimentalAction(want)
+	r.NoError(err)
+	r.Equal(action, parsed)
+}
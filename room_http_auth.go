@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// HTTPAuthChallengeSize is the number of random bytes in a challenge of the rooms2 HTTP authentication
+const HTTPAuthChallengeSize = 32
+
+// ErrInvalidHTTPAuthChallenge is returned (wrapped) if a challenge is not base64 or has the wrong length
+var ErrInvalidHTTPAuthChallenge = errors.New("ssb/http-auth: invalid challenge")
+
+// NewHTTPAuthChallenge returns a fresh, url-safe base64 encoded challenge nonce.
+// Servers use it for sc and clients for cc.
+func NewHTTPAuthChallenge() (string, error) {
+	return newHTTPAuthChallenge(rand.Reader)
+}
+
+func newHTTPAuthChallenge(r io.Reader) (string, error) {
+	nonce := make([]byte, HTTPAuthChallengeSize)
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return "", fmt.Errorf("ssb/http-auth: failed to read nonce: %w", err)
+	}
+	return base64.URLEncoding.EncodeToString(nonce), nil
+}
+
+// DecodeHTTPAuthChallenge accepts url-safe and standard base64 and checks the length of the nonce.
+func DecodeHTTPAuthChallenge(s string) ([]byte, error) {
+	nonce, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		nonce, err = base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("not base64: %w", ErrInvalidHTTPAuthChallenge)
+		}
+	}
+	if n := len(nonce); n != HTTPAuthChallengeSize {
+		return nil, fmt.Errorf("nonce has wrong length %d: %w", n, ErrInvalidHTTPAuthChallenge)
+	}
+	return nonce, nil
+}
+
+// HTTPAuthSolution is what a client signs to sign into a rooms2 server over HTTP.
+// See https://ssb-ngi-pointer.github.io/ssb-http-auth-spec/
+type HTTPAuthSolution struct {
+	ServerID FeedRef
+	ClientID FeedRef
+
+	ServerChallenge string
+	ClientChallenge string
+}
+
+// Message returns the string that is signed by the client: =http-auth-sign-in:${sid}:${cid}:${sc}:${cc}
+func (s HTTPAuthSolution) Message() []byte {
+	var msg bytes.Buffer
+	msg.WriteString("=http-auth-sign-in:")
+	msg.WriteString(s.ServerID.Sigil())
+	msg.WriteString(":")
+	msg.WriteString(s.ClientID.Sigil())
+	msg.WriteString(":")
+	msg.WriteString(s.ServerChallenge)
+	msg.WriteString(":")
+	msg.WriteString(s.ClientChallenge)
+	return msg.Bytes()
+}
+
+// Sign returns the signature of the solution, made with the private key of the client.
+func (s HTTPAuthSolution) Sign(priv ed25519.PrivateKey) ([]byte, error) {
+	if err := s.checkChallenges(); err != nil {
+		return nil, err
+	}
+
+	pub, ok := priv.Public().(ed25519.PublicKey)
+	if !ok || !bytes.Equal(pub, s.ClientID.PubKey()) {
+		return nil, fmt.Errorf("ssb/http-auth: private key does not belong to %s", s.ClientID.ShortSigil())
+	}
+
+	return ed25519.Sign(priv, s.Message()), nil
+}
+
+// Verify checks that sig was made by the client for this solution.
+func (s HTTPAuthSolution) Verify(sig []byte) error {
+	if err := s.checkChallenges(); err != nil {
+		return err
+	}
+	if !ed25519.Verify(s.ClientID.PubKey(), s.Message(), sig) {
+		return ErrInvalidSig
+	}
+	return nil
+}
+
+func (s HTTPAuthSolution) checkChallenges() error {
+	if _, err := DecodeHTTPAuthChallenge(s.ServerChallenge); err != nil {
+		return fmt.Errorf("ssb/http-auth: server challenge: %w", err)
+	}
+	if _, err := DecodeHTTPAuthChallenge(s.ClientChallenge); err != nil {
+		return fmt.Errorf("ssb/http-auth: client challenge: %w", err)
+	}
+	return nil
+}
+
+// Solution returns the solution for the challenge of the action, to be signed by the client.
+func (a StartHTTPAuthAction) Solution(clientID FeedRef, clientChallenge string) HTTPAuthSolution {
+	return HTTPAuthSolution{
+		ServerID:        a.ServerID,
+		ClientID:        clientID,
+		ServerChallenge: a.Challenge,
+		ClientChallenge: clientChallenge,
+	}
+}
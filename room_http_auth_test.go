@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestHTTPAuthFlow(t *testing.T) {
+	r := require.New(t)
+
+	serverPub, serverPriv, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte("s"), 64)))
+	r.NoError(err)
+	clientPub, clientPriv, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte("c"), 64)))
+	r.NoError(err)
+
+	serverID, err := NewFeedRefFromBytes(serverPub, RefAlgoFeedSSB1)
+	r.NoError(err)
+	clientID, err := NewFeedRefFromBytes(clientPub, RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// the server creates the link
+	sc, err := NewHTTPAuthChallenge()
+	r.NoError(err)
+	u, err := NewExperimentalURI(HTTPAuth(serverID, sc))
+	r.NoError(err)
+
+	// the client opens it
+	action, err := ParseExperimentalAction(u.String())
+	r.NoError(err)
+	start, ok := action.(StartHTTPAuthAction)
+	r.True(ok, "wrong type %T", action)
+	r.Equal(serverID, start.ServerID)
+	r.Equal(sc, start.Challenge)
+
+	cc, err := newHTTPAuthChallenge(bytes.NewReader(bytes.Repeat([]byte{0xff}, 32)))
+	r.NoError(err)
+	r.Equal("__________________________________________8=", cc)
+
+	solution := start.Solution(clientID, cc)
+	r.Equal("=http-auth-sign-in:"+serverID.Sigil()+":"+clientID.Sigil()+":"+sc+":"+cc, string(solution.Message()))
+
+	_, err = solution.Sign(serverPriv)
+	r.Error(err)
+
+	sig, err := solution.Sign(clientPriv)
+	r.NoError(err)
+	r.NoError(solution.Verify(sig))
+
+	// the server checks it
+	tampered := solution
+	tampered.ServerChallenge, err = NewHTTPAuthChallenge()
+	r.NoError(err)
+	r.True(errors.Is(tampered.Verify(sig), ErrInvalidSig))
+
+	tampered.ClientChallenge = "c2hvcnQ="
+	r.True(errors.Is(tampered.Verify(sig), ErrInvalidHTTPAuthChallenge))
+}
+
+func TestHTTPAuthBuilders(t *testing.T) {
+	r := require.New(t)
+
+	_, err := NewExperimentalURI(HTTPAuth(FeedRef{}, "tooshort"))
+	r.True(errors.Is(err, ErrInvalidHTTPAuthChallenge))
+
+	_, err = NewExperimentalURI(HTTPInvite("code", "room.example/invite"))
+	r.Error(err)
+
+	u, err := NewExperimentalURI(HTTPInvite("code", "https://room.example/invite/consume"))
+	r.NoError(err)
+	r.Equal("ssb:experimental?action=claim-http-invite&invite=code&postTo=https%3A%2F%2Froom.example%2Finvite%2Fconsume", u.String())
+
+	action, err := ParseExperimentalAction(u.String())
+	r.NoError(err)
+	r.Equal(ClaimHTTPInviteAction{Invite: "code", PostTo: "https://room.example/invite/consume"}, action)
+}
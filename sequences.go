@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+// latestSequences keeps the sequence of the latest message of each author about a subject,
+// for indexes where a newer message replaces an older one, no matter in which order they are added.
+// The subject needs to be comparable, like a MessageRef or a string.
+type latestSequences map[latestKey]int64
+
+type latestKey struct {
+	author  FeedRef
+	subject interface{}
+}
+
+// advance records seq and returns true if it is newer than what the author said about subject so far.
+// If it returns false, the message needs to be ignored.
+func (ls latestSequences) advance(author FeedRef, subject interface{}, seq int64) bool {
+	key := latestKey{author: author, subject: subject}
+	if current, has := ls[key]; has && current >= seq {
+		return false
+	}
+	ls[key] = seq
+	return true
+}
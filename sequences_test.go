@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestSequences(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		alice = newTestFeed('a')
+		bob   = newTestFeed('b')
+		msg   = fakeRef("msg")
+	)
+
+	ls := make(latestSequences)
+	r.True(ls.advance(alice, msg, 5))
+	r.False(ls.advance(alice, msg, 5), "the same message again")
+	r.False(ls.advance(alice, msg, 3), "an older message")
+	r.True(ls.advance(alice, msg, 6))
+
+	// authors and subjects are tracked separately
+	r.True(ls.advance(bob, msg, 1))
+	r.True(ls.advance(alice, fakeRef("other"), 1))
+	r.True(ls.advance(alice, "#ssb", 1))
+}
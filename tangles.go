@@ -88,7 +88,7 @@ func (by *ByPrevious) Len() int {
 	return len(by.Items)
 }
 
-func (by ByPrevious) pointsTo(x, y string) bool {
+func (by *ByPrevious) pointsTo(x, y string) bool {
 	pointsTo, has := by.after[x]
 	if !has {
 		return false
@@ -105,7 +105,7 @@ func (by ByPrevious) pointsTo(x, y string) bool {
 	return false
 }
 
-func (by ByPrevious) hopsToRoot(key string, hop int) int {
+func (by *ByPrevious) hopsToRoot(key string, hop int) int {
 	if key == by.root {
 		return hop
 	}
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// TangleGraph is a debugging view of a tangle as an adjacency list.
+// It can be written as JSON or in the DOT language of graphviz.
+type TangleGraph struct {
+	TangleName string            `json:"tangle"`
+	Nodes      []TangleGraphNode `json:"nodes"`
+}
+
+// TangleGraphNode is a single message in a TangleGraph
+type TangleGraphNode struct {
+	Key   MessageRef `json:"key"`
+	Label string     `json:"label"`
+
+	// Previous are the messages this one points to
+	Previous []MessageRef `json:"previous"`
+
+	// Head is true if no other message points to this one
+	Head bool `json:"head,omitempty"`
+
+	// Missing is set for messages that are referenced as previous but were not part of the items
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Graph returns the tangle of the items as a TangleGraph, in the current order of the items.
+func (by *ByPrevious) Graph() TangleGraph {
+	g := TangleGraph{TangleName: by.TangleName}
+
+	var (
+		known      = make(map[MessageRef]struct{}, len(by.Items))
+		referenced = make(map[MessageRef]struct{}, len(by.Items))
+	)
+	for _, m := range by.Items {
+		known[m.Key()] = struct{}{}
+	}
+
+	var missing []MessageRef
+	for _, m := range by.Items {
+		_, prev := m.Tangle(by.TangleName)
+
+		node := TangleGraphNode{
+			Key:      m.Key(),
+			Label:    m.Key().ShortSigil(),
+			Previous: []MessageRef(prev),
+		}
+		if node.Previous == nil {
+			node.Previous = []MessageRef{}
+		}
+
+		for _, p := range prev {
+			referenced[p] = struct{}{}
+			if _, has := known[p]; !has {
+				known[p] = struct{}{}
+				missing = append(missing, p)
+			}
+		}
+		g.Nodes = append(g.Nodes, node)
+	}
+
+	for i, n := range g.Nodes {
+		if _, has := referenced[n.Key]; !has {
+			g.Nodes[i].Head = true
+		}
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].String() < missing[j].String()
+	})
+	for _, m := range missing {
+		g.Nodes = append(g.Nodes, TangleGraphNode{
+			Key:      m,
+			Label:    m.ShortSigil(),
+			Previous: []MessageRef{},
+			Missing:  true,
+		})
+	}
+
+	return g
+}
+
+// WriteJSON writes the graph as indented JSON
+func (g TangleGraph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the graph in the DOT language of graphviz.
+// Edges point from a message to its previous, heads are filled and missing messages are drawn dashed.
+func (g TangleGraph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "digraph %q {\n", "tangle-"+g.TangleName)
+	fmt.Fprintln(bw, "\trankdir=BT;")
+	fmt.Fprintln(bw, "\tnode [shape=box, fontname=monospace];")
+
+	for _, n := range g.Nodes {
+		var style string
+		switch {
+		case n.Missing:
+			style = ", style=dashed"
+		case n.Head:
+			style = ", style=filled, fillcolor=lightblue"
+		}
+		fmt.Fprintf(bw, "\t%q [label=%q%s];\n", n.Key.String(), n.Label, style)
+	}
+
+	for _, n := range g.Nodes {
+		for _, p := range n.Previous {
+			fmt.Fprintf(bw, "\t%q -> %q;\n", n.Key.String(), p.String())
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTangleGraphExport(t *testing.T) {
+	r := require.New(t)
+
+	items := []TangledPost{
+		tangleMsg{key: "r0"},
+		tangleMsg{key: "a1", root: "r0", prev: []string{"r0"}},
+		tangleMsg{key: "b1", root: "r0", prev: []string{"r0", "gone"}},
+	}
+
+	sorter := ByPrevious{TangleName: "test", Items: items}
+	g := sorter.Graph()
+
+	r.Len(g.Nodes, 4)
+	r.False(g.Nodes[0].Head)
+	r.True(g.Nodes[1].Head)
+	r.True(g.Nodes[2].Head)
+	r.True(g.Nodes[3].Missing)
+	r.Equal(fakeRef("gone"), g.Nodes[3].Key)
+
+	var dot bytes.Buffer
+	r.NoError(g.WriteDOT(&dot))
+
+	out := dot.String()
+	r.True(strings.HasPrefix(out, `digraph "tangle-test" {`), out)
+	r.Contains(out, fakeRef("gone").ShortSigil()+`", style=dashed];`)
+	r.Contains(out, fakeRef("a1").ShortSigil()+`", style=filled, fillcolor=lightblue];`)
+	r.Equal(3, strings.Count(out, " -> "))
+
+	var js bytes.Buffer
+	r.NoError(g.WriteJSON(&js))
+
+	var decoded struct {
+		Tangle string `json:"tangle"`
+		Nodes  []struct {
+			Label    string   `json:"label"`
+			Previous []string `json:"previous"`
+			Head     bool     `json:"head"`
+			Missing  bool     `json:"missing"`
+		} `json:"nodes"`
+	}
+	r.NoError(json.Unmarshal(js.Bytes(), &decoded))
+	r.Equal("test", decoded.Tangle)
+	r.Len(decoded.Nodes, 4)
+	r.Equal(fakeRef("r0").ShortSigil(), decoded.Nodes[0].Label)
+	r.Len(decoded.Nodes[2].Previous, 2)
+	r.True(decoded.Nodes[3].Missing)
+}
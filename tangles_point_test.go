@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTanglePointGolden(t *testing.T) {
+	type tcase struct {
+		name   string
+		input  string
+		golden string
+	}
+
+	var cases = []tcase{
+		{
+			name:   "root",
+			input:  `{"previous": null, "root": null}`,
+			golden: `{"root":null,"previous":null}`,
+		},
+		{
+			name:   "root with empty previous",
+			input:  `{"root": null, "previous": [ ]}`,
+			golden: `{"root":null,"previous":null}`,
+		},
+		{
+			name: "single previous",
+			input: `{
+				"root": "%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256",
+				"previous": ["%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]
+			}`,
+			golden: `{"root":"%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256","previous":["%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]}`,
+		},
+		{
+			name: "order of previous is kept",
+			input: `{
+				"root": "%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256",
+				"previous": [
+					"%yJAzwPO7HSjvHRp7wrVGO4sbo9GHSwKk0BXOSiUr+bo=.sha256",
+					"%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"
+				]
+			}`,
+			golden: `{"root":"%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256","previous":["%yJAzwPO7HSjvHRp7wrVGO4sbo9GHSwKk0BXOSiUr+bo=.sha256","%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]}`,
+		},
+		{
+			name: "tangles v1 single ref",
+			input: `{
+				"root": "%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256",
+				"previous": "%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"
+			}`,
+			golden: `{"root":"%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256","previous":["%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]}`,
+		},
+		{
+			name:   "ssb-uri",
+			input:  `{"root":"ssb:message/bendybutt-v1/PR2-btDEO1AjXuPl0TJ2N_hFB2bbFLIHlty0VF1nctw=","previous":["ssb:message/bendybutt-v1/2jDrrJEeG7PQcCLcisISqarMboNpnwyfxLnwU1ijOjc="]}`,
+			golden: `{"root":"ssb:message/bendybutt-v1/PR2-btDEO1AjXuPl0TJ2N_hFB2bbFLIHlty0VF1nctw=","previous":["ssb:message/bendybutt-v1/2jDrrJEeG7PQcCLcisISqarMboNpnwyfxLnwU1ijOjc="]}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			var tp TanglePoint
+			r.NoError(json.Unmarshal([]byte(tc.input), &tp))
+
+			out, err := json.Marshal(tp)
+			r.NoError(err)
+			r.Equal(tc.golden, string(out))
+
+			// and again
+			var again TanglePoint
+			r.NoError(json.Unmarshal(out, &again))
+			r.Equal(tp, again)
+		})
+	}
+}
+
+func TestTanglePointInvalid(t *testing.T) {
+	var cases = []string{
+		`null`,
+		`[]`,
+		`{"root": null}`,
+		`{"previous": null}`,
+		`{"root": null, "previous": null, "extra": 1}`,
+		`{"root": null, "previous": ["%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]}`,
+		`{"root": "%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256", "previous": null}`,
+		`{"root": "%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256", "previous": []}`,
+		`{"root": "%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256", "previous": [1]}`,
+		`{"root": 23, "previous": ["%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]}`,
+	}
+
+	for i, input := range cases {
+		var tp TanglePoint
+		err := json.Unmarshal([]byte(input), &tp)
+		require.Error(t, err, "case %d", i)
+		require.True(t, errors.Is(err, ErrInvalidTanglePoint), "case %d: %s", i, err)
+	}
+
+	// invalid references are reported as such
+	var tp TanglePoint
+	err := json.Unmarshal([]byte(`{"root": "%no*pe.sha256", "previous": ["%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]}`), &tp)
+	require.True(t, errors.Is(err, ErrInvalidHash), "%s", err)
+
+	// marshal is strict as well
+	var root MessageRef
+	_, err = json.Marshal(TanglePoint{Root: &root})
+	require.True(t, errors.Is(err, ErrInvalidTanglePoint))
+	_, err = json.Marshal(TanglePoint{Previous: MessageRefs{root}})
+	require.True(t, errors.Is(err, ErrInvalidTanglePoint))
+}
+
+func TestPostTanglesRoundtrip(t *testing.T) {
+	r := require.New(t)
+
+	input := `{"type":"post","text":"hi","tangles":{"post":{"root":null,"previous":null},"other":{"root":"%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256","previous":["%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]}}}`
+
+	var p Post
+	r.NoError(json.Unmarshal([]byte(input), &p))
+	r.Len(p.Tangles, 2)
+	r.Nil(p.Tangles["post"].Root)
+
+	out, err := json.Marshal(p)
+	r.NoError(err)
+	r.JSONEq(input, string(out))
+	r.Contains(string(out), `"post":{"root":null,"previous":null}`)
+}
+
+// TestPostTanglesRealWorld pins what happens to content with tangle points that don't follow the spec, as they show up on the network.
+// Decoding is strict, so one bad point makes the whole post unreadable.
+func TestPostTanglesRealWorld(t *testing.T) {
+	// root point with an empty array instead of null, which many clients write
+	var root Post
+	input := `{"type":"post","text":"hi","tangles":{"post":{"root":null,"previous":[]}}}`
+	require.NoError(t, json.Unmarshal([]byte(input), &root))
+	require.Nil(t, root.Tangles["post"].Root)
+	require.Empty(t, root.Tangles["post"].Previous)
+	c, err := DecodeContent(Value{Content: []byte(input)})
+	require.NoError(t, err)
+	require.Equal(t, "hi", c.(*Post).Text)
+
+	var cases = []string{
+		// reply that lost its previous
+		`{"type":"post","text":"hi","tangles":{"post":{"root":"%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256","previous":[]}}}`,
+		// only one broken point next to a valid one
+		`{"type":"post","text":"hi","tangles":{"post":{"root":null,"previous":null},"other":{"root":null}}}`,
+	}
+
+	for i, input := range cases {
+		var p Post
+		err := json.Unmarshal([]byte(input), &p)
+		require.True(t, errors.Is(err, ErrInvalidTanglePoint), "case %d: %v", i, err)
+
+		_, err = DecodeContent(Value{Content: []byte(input)})
+		require.True(t, errors.Is(err, ErrInvalidTanglePoint), "case %d: %v", i, err)
+	}
+
+	// the v1 form with a single previous is accepted
+	var p Post
+	err = json.Unmarshal([]byte(`{"type":"post","text":"hi","tangles":{"post":{"root":"%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256","previous":"%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"}}}`), &p)
+	require.NoError(t, err)
+	require.Len(t, p.Tangles["post"].Previous, 1)
+}
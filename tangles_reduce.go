@@ -0,0 +1,367 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrTangleBadTransformation is used in TangleReport.Invalid for messages that were part of the tangle but their transformation couldn't be parsed.
+// They are removed from TangleReport.Valid and their changes are ignored, but their position in the tangle is kept for causal ordering.
+var ErrTangleBadTransformation = errors.New("ssb/tangle: invalid transformation")
+
+// TangleTransformation is a message in a tangle that changes some fields of a collaborative record (ala ssb-crut).
+type TangleTransformation interface {
+	TangledPost
+
+	// Transformation returns the raw JSON of each field the message wants to change
+	Transformation() map[string]json.RawMessage
+}
+
+// TangleStrategy defines how the transformations of a single field are parsed and combined.
+// See https://gitlab.com/tangle-js/strategy for the general idea.
+type TangleStrategy interface {
+	// Identity is the state of a field before any transformation was applied
+	Identity() interface{}
+
+	// Parse checks and decodes the raw JSON transformation of a message
+	Parse(json.RawMessage) (interface{}, error)
+
+	// Concat applies transformation b after state a and returns the new state
+	Concat(a, b interface{}) interface{}
+
+	// Reify turns the accumulated state into the value a user should see
+	Reify(interface{}) interface{}
+}
+
+// TangleReducer walks a tangle in causal order and combines the transformations of each message.
+// Concurrent messages (on different branches) are applied in a deterministic order:
+// first by their distance to the root and then by their key.
+// This way, two peers that have the same set of messages always end up with the same state.
+type TangleReducer struct {
+	Root       MessageRef
+	TangleName string
+
+	// Strategies holds the strategy for every field of the record, other fields are ignored.
+	Strategies map[string]TangleStrategy
+}
+
+// TangleState is the result of TangleReducer.Reduce
+type TangleState struct {
+	// Fields holds the reified value for each field of the strategies
+	Fields map[string]interface{}
+
+	// Heads are the valid messages that are not referenced by any other message yet.
+	// New updates should use these as their previous.
+	// It is empty if the root was not passed to Reduce or is invalid and nothing else is valid either.
+	Heads MessageRefs
+
+	// Report explains which messages were ignored
+	Report TangleReport
+}
+
+// Reduce validates the tangle (see ValidateTangle) and applies the transformations of all valid messages.
+func (tr TangleReducer) Reduce(msgs []TangleTransformation) (TangleState, error) {
+	if tr.TangleName == "" {
+		return TangleState{}, fmt.Errorf("ssb/tangle: reducer needs a tangle name")
+	}
+
+	tangled := make([]TangledPost, len(msgs))
+	for i, m := range msgs {
+		tangled[i] = m
+	}
+
+	report := ValidateTangle(tr.Root, tr.TangleName, tangled)
+
+	var (
+		byKey    = make(map[MessageRef]TangleTransformation, len(msgs))
+		children = make(map[MessageRef]MessageRefs, len(msgs))
+		waitFor  = make(map[MessageRef]int, len(msgs))
+	)
+	for _, m := range report.Filter(tangled) {
+		key := m.Key()
+		byKey[key] = m.(TangleTransformation)
+
+		_, prev := m.Tangle(tr.TangleName)
+		waitFor[key] = len(prev)
+		for _, p := range prev {
+			children[p] = append(children[p], key)
+		}
+	}
+
+	state := make(map[string]interface{}, len(tr.Strategies))
+	for field, strat := range tr.Strategies {
+		state[field] = strat.Identity()
+	}
+
+	apply := func(key MessageRef) {
+		m, has := byKey[key]
+		if !has { // root that wasn't passed in
+			return
+		}
+
+		changes := m.Transformation()
+		parsed := make(map[string]interface{}, len(changes))
+		for field, strat := range tr.Strategies {
+			raw, has := changes[field]
+			if !has {
+				continue
+			}
+
+			t, err := strat.Parse(raw)
+			if err != nil {
+				report.reject(key, fmt.Errorf("field %q: %s: %w", field, err, ErrTangleBadTransformation))
+				return
+			}
+			parsed[field] = t
+		}
+
+		for field, t := range parsed {
+			state[field] = tr.Strategies[field].Concat(state[field], t)
+		}
+	}
+
+	// the root is only a head if it was passed in and is valid, not just because nothing points to it
+	_, rootValid := byKey[tr.Root]
+
+	// topological walk, always picking the closest and then smallest key from the ready ones.
+	// The depth of a message is final once it is ready, since all its previous were applied.
+	var (
+		depth = map[MessageRef]int{tr.Root: 0}
+		ready = &reduceQueue{{key: tr.Root, str: tr.Root.String()}}
+		heads MessageRefs
+	)
+	for ready.Len() > 0 {
+		current := heap.Pop(ready).(reduceItem).key
+
+		apply(current)
+
+		next := children[current]
+		if len(next) == 0 && (rootValid || !current.Equal(tr.Root)) {
+			heads = append(heads, current)
+		}
+		for _, c := range next {
+			if d := depth[current] + 1; d > depth[c] {
+				depth[c] = d
+			}
+			waitFor[c]--
+			if waitFor[c] == 0 {
+				heap.Push(ready, reduceItem{key: c, depth: depth[c], str: c.String()})
+			}
+		}
+	}
+
+	fields := make(map[string]interface{}, len(state))
+	for field, s := range state {
+		fields[field] = tr.Strategies[field].Reify(s)
+	}
+
+	return TangleState{
+		Fields: fields,
+		Heads:  heads,
+		Report: report,
+	}, nil
+}
+
+// reduceItem is a message that is ready to be applied. str caches the key as a string for ordering.
+type reduceItem struct {
+	key   MessageRef
+	depth int
+	str   string
+}
+
+// reduceQueue is a min-heap of the ready messages, by depth and then by key
+type reduceQueue []reduceItem
+
+func (q reduceQueue) Len() int { return len(q) }
+
+func (q reduceQueue) Less(i, j int) bool {
+	if q[i].depth != q[j].depth {
+		return q[i].depth < q[j].depth
+	}
+	return q[i].str < q[j].str
+}
+
+func (q reduceQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *reduceQueue) Push(x interface{}) { *q = append(*q, x.(reduceItem)) }
+
+func (q *reduceQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// TangleOverwrite is a strategy for single values where the last write wins.
+// Transformations look like {"set": value}, the reified value is the json.RawMessage of the last set (or nil).
+type TangleOverwrite struct{}
+
+var _ TangleStrategy = TangleOverwrite{}
+
+// Identity implements TangleStrategy
+func (TangleOverwrite) Identity() interface{} { return json.RawMessage(nil) }
+
+// Parse implements TangleStrategy
+func (TangleOverwrite) Parse(raw json.RawMessage) (interface{}, error) {
+	var t struct {
+		Set json.RawMessage `json:"set"`
+	}
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	if t.Set == nil {
+		return nil, fmt.Errorf("overwrite: transformation without set")
+	}
+	return t.Set, nil
+}
+
+// Concat implements TangleStrategy
+func (TangleOverwrite) Concat(a, b interface{}) interface{} {
+	if bv := b.(json.RawMessage); bv != nil {
+		return bv
+	}
+	return a
+}
+
+// Reify implements TangleStrategy
+func (TangleOverwrite) Reify(s interface{}) interface{} { return s }
+
+// TangleSet is a strategy for a set of named values where each key is overwritten independently.
+// Transformations look like {"key": value, "other": null}, where null removes the key.
+// The reified value is a map[string]json.RawMessage.
+type TangleSet struct{}
+
+var _ TangleStrategy = TangleSet{}
+
+// Identity implements TangleStrategy
+func (TangleSet) Identity() interface{} { return map[string]json.RawMessage{} }
+
+// Parse implements TangleStrategy
+func (TangleSet) Parse(raw json.RawMessage) (interface{}, error) {
+	var t map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("set: transformation is not an object")
+	}
+	return t, nil
+}
+
+// Concat implements TangleStrategy
+func (TangleSet) Concat(a, b interface{}) interface{} {
+	av, bv := a.(map[string]json.RawMessage), b.(map[string]json.RawMessage)
+	out := make(map[string]json.RawMessage, len(av)+len(bv))
+	for k, v := range av {
+		out[k] = v
+	}
+	for k, v := range bv {
+		if string(v) == "null" {
+			delete(out, k)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Reify implements TangleStrategy
+func (TangleSet) Reify(s interface{}) interface{} { return s }
+
+// TangleSimpleSet is a strategy for a set of strings (like @tangle/simple-set).
+// Transformations look like {"add-me": 1, "remove-me": -1}, a value is part of the set as long as the sum of its changes is positive.
+// The reified value is a sorted []string.
+type TangleSimpleSet struct{}
+
+var _ TangleStrategy = TangleSimpleSet{}
+
+// Identity implements TangleStrategy
+func (TangleSimpleSet) Identity() interface{} { return map[string]int{} }
+
+// Parse implements TangleStrategy
+func (TangleSimpleSet) Parse(raw json.RawMessage) (interface{}, error) {
+	var t map[string]int
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	for k, v := range t {
+		if v != 1 && v != -1 {
+			return nil, fmt.Errorf("simple-set: %q has invalid value %d", k, v)
+		}
+	}
+	return t, nil
+}
+
+// Concat implements TangleStrategy
+func (TangleSimpleSet) Concat(a, b interface{}) interface{} {
+	av, bv := a.(map[string]int), b.(map[string]int)
+	out := make(map[string]int, len(av)+len(bv))
+	for k, v := range av {
+		out[k] = v
+	}
+	for k, v := range bv {
+		out[k] += v
+	}
+	return out
+}
+
+// Reify implements TangleStrategy
+func (TangleSimpleSet) Reify(s interface{}) interface{} {
+	var members = []string{}
+	for k, v := range s.(map[string]int) {
+		if v > 0 {
+			members = append(members, k)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// TangledContent holds the key, tangles and all other fields of a message's content.
+// It implements TangleTransformation.
+type TangledContent struct {
+	key     MessageRef
+	tangles Tangles
+	fields  map[string]json.RawMessage
+}
+
+var _ TangleTransformation = TangledContent{}
+
+// NewTangledContent decodes the content of a message as tangled fields.
+func NewTangledContent(key MessageRef, content json.RawMessage) (TangledContent, error) {
+	var tc = TangledContent{key: key}
+
+	if err := json.Unmarshal(content, &tc.fields); err != nil {
+		return tc, fmt.Errorf("tangled content: not an object: %w", err)
+	}
+
+	if raw, has := tc.fields["tangles"]; has {
+		if err := json.Unmarshal(raw, &tc.tangles); err != nil {
+			return tc, fmt.Errorf("tangled content: invalid tangles: %w", err)
+		}
+		delete(tc.fields, "tangles")
+	}
+	return tc, nil
+}
+
+// Key implements TangledPost
+func (tc TangledContent) Key() MessageRef { return tc.key }
+
+// Tangle implements TangledPost
+func (tc TangledContent) Tangle(name string) (*MessageRef, MessageRefs) {
+	tp, has := tc.tangles[name]
+	if !has {
+		return nil, nil
+	}
+	return tp.Root, tp.Previous
+}
+
+// Transformation implements TangleTransformation
+func (tc TangledContent) Transformation() map[string]json.RawMessage { return tc.fields }
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type transformMsg struct {
+	tangleMsg
+	fields map[string]json.RawMessage
+}
+
+func (tm transformMsg) Transformation() map[string]json.RawMessage { return tm.fields }
+
+func newTransform(key, root string, prev []string, fields string) transformMsg {
+	tm := transformMsg{tangleMsg: tangleMsg{key: key, root: root, prev: prev}}
+	if err := json.Unmarshal([]byte(fields), &tm.fields); err != nil {
+		panic(err)
+	}
+	return tm
+}
+
+func TestTangleReducer(t *testing.T) {
+	r := require.New(t)
+
+	//       r0
+	//      /  \
+	//    a1    b1
+	//      \  /  \
+	//       a2    b2
+	msgs := []TangleTransformation{
+		newTransform("r0", "", nil, `{"name": {"set": "first"}, "tags": {"x": 1}, "links": {"home": "a"}}`),
+		newTransform("a1", "r0", []string{"r0"}, `{"name": {"set": "from a"}, "tags": {"y": 1}}`),
+		newTransform("b1", "r0", []string{"r0"}, `{"name": {"set": "from b"}, "tags": {"x": -1}, "links": {"work": "b"}}`),
+		newTransform("a2", "r0", []string{"a1", "b1"}, `{"links": {"home": null}}`),
+		newTransform("b2", "r0", []string{"b1"}, `{"tags": {"z": 1}}`),
+		newTransform("x1", "r0", []string{"a2"}, `{"name": {"nope": "broken"}}`),
+		newTransform("f1", "r0", []string{"forged"}, `{"name": {"set": "forged"}}`),
+	}
+
+	reducer := TangleReducer{
+		Root:       fakeRef("r0"),
+		TangleName: "test",
+		Strategies: map[string]TangleStrategy{
+			"name":  TangleOverwrite{},
+			"tags":  TangleSimpleSet{},
+			"links": TangleSet{},
+		},
+	}
+
+	var first TangleState
+	for i := 0; i < 10; i++ {
+		rand.Shuffle(len(msgs), func(i, j int) {
+			msgs[i], msgs[j] = msgs[j], msgs[i]
+		})
+
+		state, err := reducer.Reduce(msgs)
+		r.NoError(err)
+
+		if i == 0 {
+			first = state
+			continue
+		}
+		r.Equal(first.Fields, state.Fields, "not deterministic")
+	}
+
+	// a1 and b1 are concurrent, b1 has the bigger key and wins
+	r.Equal(`"from b"`, string(first.Fields["name"].(json.RawMessage)))
+	r.Equal([]string{"y", "z"}, first.Fields["tags"])
+	r.Equal(map[string]json.RawMessage{"work": json.RawMessage(`"b"`)}, first.Fields["links"])
+
+	var heads []string
+	for _, h := range first.Heads {
+		heads = append(heads, string(h.hash[:2]))
+	}
+	r.ElementsMatch([]string{"b2", "x1"}, heads)
+
+	// x1 has a broken transformation, it is only invalid and not also valid
+	r.Len(first.Report.Invalid, 2)
+	invalid := make(map[string]error)
+	for _, inv := range first.Report.Invalid {
+		invalid[string(inv.Key.hash[:2])] = inv.Reason
+	}
+	r.True(errors.Is(invalid["x1"], ErrTangleBadTransformation))
+	r.True(errors.Is(invalid["f1"], ErrTangleUnknownPrev))
+
+	var valid []string
+	for _, v := range first.Report.Valid {
+		valid = append(valid, string(v.hash[:2]))
+	}
+	r.ElementsMatch([]string{"r0", "a1", "b1", "a2", "b2"}, valid)
+	r.False(first.Report.IsValid(fakeRef("x1")))
+	r.True(first.Report.IsValid(fakeRef("b2")))
+}
+
+func TestTangleReducerForgedRoot(t *testing.T) {
+	r := require.New(t)
+
+	msgs := []TangleTransformation{
+		newTransform("r0", "r0", []string{"r0"}, `{"name": {"set": "forged root"}}`),
+		newTransform("a1", "r0", []string{"r0"}, `{"name": {"set": "child of forged"}}`),
+	}
+
+	reducer := TangleReducer{
+		Root:       fakeRef("r0"),
+		TangleName: "test",
+		Strategies: map[string]TangleStrategy{"name": TangleOverwrite{}},
+	}
+
+	state, err := reducer.Reduce(msgs)
+	r.NoError(err)
+	r.Nil(state.Fields["name"])
+	r.Empty(state.Report.Valid)
+	r.Len(state.Report.Invalid, 2)
+	r.Empty(state.Heads, "the forged root is not a head")
+
+	// neither is a root that wasn't passed in
+	state, err = reducer.Reduce(nil)
+	r.NoError(err)
+	r.Empty(state.Heads)
+
+	// but a valid root without replies is
+	state, err = reducer.Reduce([]TangleTransformation{
+		newTransform("r0", "", nil, `{"name": {"set": "root"}}`),
+	})
+	r.NoError(err)
+	r.Equal(MessageRefs{fakeRef("r0")}, state.Heads)
+}
+
+func TestTangledContent(t *testing.T) {
+	r := require.New(t)
+
+	key, err := ParseMessageRef("%AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=.sha256")
+	r.NoError(err)
+
+	content := []byte(`{
+		"type": "profile/person",
+		"preferredName": {"set": "alice"},
+		"tangles": {
+			"profile": {
+				"root": "%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256",
+				"previous": ["%hCM+q/zsq8vseJKwIAAJMMdsAmWeSfG9cs8ed3uOXCc=.sha256"]
+			}
+		}
+	}`)
+
+	tc, err := NewTangledContent(key, content)
+	r.NoError(err)
+
+	root, prev := tc.Tangle("profile")
+	r.NotNil(root)
+	r.Equal("%HG1p299uO2nCenG6YwR3DG33lLpcALAS/PI6/BP5dB0=.sha256", root.String())
+	r.Len(prev, 1)
+
+	fields := tc.Transformation()
+	r.Contains(fields, "preferredName")
+	r.NotContains(fields, "tangles")
+
+	root, prev = tc.Tangle("other")
+	r.Nil(root)
+	r.Nil(prev)
+}
@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors that explain why a message was rejected by ValidateTangle
+var (
+	ErrTangleWrongRoot   = errors.New("ssb/tangle: message points to a different root")
+	ErrTangleInvalidRoot = errors.New("ssb/tangle: root message needs root:null and previous:null")
+	ErrTangleNoPrevious  = errors.New("ssb/tangle: non-root message without previous")
+	ErrTangleUnknownPrev = errors.New("ssb/tangle: previous points outside of the tangle")
+	ErrTangleInvalidPrev = errors.New("ssb/tangle: previous points to an invalid message")
+	ErrTangleDuplicate   = errors.New("ssb/tangle: message is included more than once")
+	ErrTangleCycle       = errors.New("ssb/tangle: message is part of a cycle")
+)
+
+// TangleViolation describes why a single message of a tangle was rejected.
+type TangleViolation struct {
+	Key    MessageRef
+	Reason error
+}
+
+func (tv TangleViolation) Error() string {
+	return fmt.Sprintf("%s: %s", tv.Key.ShortSigil(), tv.Reason)
+}
+
+// Unwrap returns the reason, so that errors.Is() can be used with the ErrTangle* values
+func (tv TangleViolation) Unwrap() error { return tv.Reason }
+
+// TangleReport is the result of ValidateTangle.
+type TangleReport struct {
+	Root MessageRef
+
+	// Valid holds the keys of all accepted messages in the order they were passed in
+	Valid MessageRefs
+
+	// Invalid lists the rejected messages with the reason for each of them
+	Invalid []TangleViolation
+
+	valid map[MessageRef]struct{}
+
+	// rootInvalid is set if the root was passed to ValidateTangle but is not a proper root
+	rootInvalid bool
+}
+
+// IsValid returns true if the passed message was accepted as part of the tangle.
+// The root itself is considered valid if it wasn't passed to ValidateTangle, but not if it was rejected.
+func (tr TangleReport) IsValid(key MessageRef) bool {
+	if key.Equal(tr.Root) {
+		return !tr.rootInvalid
+	}
+	_, has := tr.valid[key]
+	return has
+}
+
+// reject moves an accepted message to Invalid, for checks that happen after ValidateTangle
+func (tr *TangleReport) reject(key MessageRef, reason error) {
+	delete(tr.valid, key)
+	for i, v := range tr.Valid {
+		if v.Equal(key) {
+			tr.Valid = append(tr.Valid[:i:i], tr.Valid[i+1:]...)
+			break
+		}
+	}
+	tr.Invalid = append(tr.Invalid, TangleViolation{Key: key, Reason: reason})
+}
+
+// Filter returns the subset of msgs that are valid according to this report.
+// Only the first occurrence of a duplicated message is kept.
+func (tr TangleReport) Filter(msgs []TangledPost) []TangledPost {
+	var (
+		out  []TangledPost
+		seen = make(map[MessageRef]struct{}, len(msgs))
+	)
+	for _, m := range msgs {
+		key := m.Key()
+		if _, dupe := seen[key]; dupe || !tr.IsValid(key) {
+			continue
+		}
+		seen[key] = struct{}{}
+		out = append(out, m)
+	}
+	return out
+}
+
+// ValidateTangle checks the tangle with the given name of each message against the passed root.
+//
+// The root message (if it is part of msgs) needs to have root:null and previous:null.
+// Every other message needs to point to the same root and all entries in previous must reference messages that are valid members of the tangle.
+// Which means messages that point to rejected or unknown messages are rejected as well.
+func ValidateTangle(root MessageRef, name string, msgs []TangledPost) TangleReport {
+	report := TangleReport{
+		Root:  root,
+		valid: make(map[MessageRef]struct{}, len(msgs)),
+	}
+
+	var (
+		pending = make(map[MessageRef]MessageRefs, len(msgs))
+		order   = make([]MessageRef, 0, len(msgs))
+		seen    = make(map[MessageRef]struct{}, len(msgs))
+		invalid = make(map[MessageRef]error)
+		dupes   []TangleViolation
+	)
+
+	for _, m := range msgs {
+		key := m.Key()
+		if _, dupe := seen[key]; dupe {
+			dupes = append(dupes, TangleViolation{Key: key, Reason: ErrTangleDuplicate})
+			continue
+		}
+		seen[key] = struct{}{}
+		order = append(order, key)
+
+		tRoot, tPrev := m.Tangle(name)
+
+		if key.Equal(root) {
+			if tRoot != nil || len(tPrev) != 0 {
+				invalid[key] = ErrTangleInvalidRoot
+			}
+			continue
+		}
+
+		if tRoot == nil || !tRoot.Equal(root) {
+			invalid[key] = ErrTangleWrongRoot
+			continue
+		}
+
+		if len(tPrev) == 0 {
+			invalid[key] = ErrTangleNoPrevious
+			continue
+		}
+
+		pending[key] = tPrev
+	}
+
+	// accept messages as long as we find new ones that only point to accepted ones.
+	// a forged root takes everything that points to it down with it.
+	accepted := make(map[MessageRef]struct{})
+	if _, bad := invalid[root]; bad {
+		report.rootInvalid = true
+	} else {
+		accepted[root] = struct{}{}
+	}
+	for progress := true; progress; {
+		progress = false
+		for key, prev := range pending {
+			if !allIn(prev, accepted) {
+				continue
+			}
+			accepted[key] = struct{}{}
+			delete(pending, key)
+			progress = true
+		}
+	}
+
+	// explain what is left: first the ones pointing to unknown messages,
+	// then the ones that (transitively) point to rejected messages and lastly cycles
+	for key, prev := range pending {
+		for _, p := range prev {
+			if _, known := seen[p]; !known && !p.Equal(root) {
+				invalid[key] = ErrTangleUnknownPrev
+				delete(pending, key)
+				break
+			}
+		}
+	}
+	for progress := true; progress; {
+		progress = false
+		for key, prev := range pending {
+			for _, p := range prev {
+				if _, bad := invalid[p]; bad {
+					invalid[key] = ErrTangleInvalidPrev
+					delete(pending, key)
+					progress = true
+					break
+				}
+			}
+		}
+	}
+	for key := range pending {
+		invalid[key] = ErrTangleCycle
+	}
+
+	for _, key := range order {
+		if reason, bad := invalid[key]; bad {
+			report.Invalid = append(report.Invalid, TangleViolation{Key: key, Reason: reason})
+			continue
+		}
+		report.valid[key] = struct{}{}
+		report.Valid = append(report.Valid, key)
+	}
+	report.Invalid = append(report.Invalid, dupes...)
+
+	return report
+}
+
+func allIn(refs MessageRefs, set map[MessageRef]struct{}) bool {
+	for _, r := range refs {
+		if _, has := set[r]; !has {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tangleMsg is like fakeMessage but can express root:null
+type tangleMsg struct {
+	key  string
+	root string // empty means null
+	prev []string
+}
+
+func fakeRef(s string) MessageRef {
+	r := MessageRef{algo: "fake"}
+	copy(r.hash[:], s)
+	return r
+}
+
+func (tm tangleMsg) Key() MessageRef { return fakeRef(tm.key) }
+
+func (tm tangleMsg) Tangle(_ string) (*MessageRef, MessageRefs) {
+	var root *MessageRef
+	if tm.root != "" {
+		r := fakeRef(tm.root)
+		root = &r
+	}
+	var prev MessageRefs
+	for _, p := range tm.prev {
+		prev = append(prev, fakeRef(p))
+	}
+	return root, prev
+}
+
+func TestValidateTangle(t *testing.T) {
+	r := require.New(t)
+
+	msgs := []TangledPost{
+		tangleMsg{key: "r0"},
+		tangleMsg{key: "a1", root: "r0", prev: []string{"r0"}},
+		tangleMsg{key: "b1", root: "r0", prev: []string{"r0"}},
+		tangleMsg{key: "a2", root: "r0", prev: []string{"a1", "b1"}},
+
+		tangleMsg{key: "x1", root: "zz", prev: []string{"r0"}},       // other root
+		tangleMsg{key: "x2", root: "r0", prev: []string{"x1"}},       // points to a rejected one
+		tangleMsg{key: "x3", root: "r0", prev: []string{"x2"}},       // transitivly as well
+		tangleMsg{key: "x4", root: "r0", prev: []string{"nope"}},     // unknown
+		tangleMsg{key: "x5", root: "r0"},                             // no previous
+		tangleMsg{key: "c1", root: "r0", prev: []string{"c2"}},       // cycle
+		tangleMsg{key: "c2", root: "r0", prev: []string{"c1"}},       // cycle
+		tangleMsg{key: "a1", root: "r0", prev: []string{"a2", "r0"}}, // duplicate
+	}
+
+	report := ValidateTangle(fakeRef("r0"), "test", msgs)
+
+	var validKeys []string
+	for _, v := range report.Valid {
+		validKeys = append(validKeys, string(v.hash[:2]))
+	}
+	r.Equal([]string{"r0", "a1", "b1", "a2"}, validKeys)
+
+	want := map[string]error{
+		"x1": ErrTangleWrongRoot,
+		"x2": ErrTangleInvalidPrev,
+		"x3": ErrTangleInvalidPrev,
+		"x4": ErrTangleUnknownPrev,
+		"x5": ErrTangleNoPrevious,
+		"c1": ErrTangleCycle,
+		"c2": ErrTangleCycle,
+		"a1": ErrTangleDuplicate,
+	}
+	r.Len(report.Invalid, len(want))
+	for _, inv := range report.Invalid {
+		k := string(inv.Key.hash[:2])
+		r.True(errors.Is(inv, want[k]), "%s: wrong reason: %s", k, inv.Reason)
+	}
+
+	r.True(report.IsValid(fakeRef("a2")))
+	r.False(report.IsValid(fakeRef("x2")))
+	r.Len(report.Filter(msgs), 4)
+}
+
+func TestValidateTangleBrokenRoot(t *testing.T) {
+	r := require.New(t)
+
+	msgs := []TangledPost{
+		tangleMsg{key: "r0", root: "r0", prev: []string{"r0"}},
+		tangleMsg{key: "a1", root: "r0", prev: []string{"r0"}},
+	}
+
+	report := ValidateTangle(fakeRef("r0"), "test", msgs)
+	r.Len(report.Invalid, 2)
+	r.True(errors.Is(report.Invalid[0], ErrTangleInvalidRoot))
+
+	// a1 points to the forged root, so it is rejected as well
+	r.True(errors.Is(report.Invalid[1], ErrTangleInvalidPrev))
+	r.Empty(report.Valid)
+
+	r.False(report.IsValid(fakeRef("r0")))
+	r.False(report.IsValid(fakeRef("a1")))
+	r.Empty(report.Filter(msgs))
+
+	// without the root message, the root key is still considered part of the tangle
+	report = ValidateTangle(fakeRef("r0"), "test", msgs[1:])
+	r.Empty(report.Invalid)
+	r.True(report.IsValid(fakeRef("r0")))
+	r.Len(report.Filter(msgs[1:]), 1)
+}
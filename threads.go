@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"sort"
+)
+
+// ThreadTangleName is the name of the tangle posts use to form a thread.
+const ThreadTangleName = "post"
+
+// ThreadPost adapts a Post to the TangledPost interface.
+// It uses the v2 tangle information from Tangles["post"] if present,
+// otherwise it falls back to the legacy root and branch fields.
+type ThreadPost struct {
+	key MessageRef
+
+	Post Post
+
+	// knownBranch replaces Post.Branch once BuildThread removed the entries it doesn't have
+	knownBranch MessageRefs
+}
+
+var _ TangledPost = ThreadPost{}
+
+// NewThreadPost returns a new ThreadPost for the post with the passed key.
+func NewThreadPost(key MessageRef, p Post) ThreadPost {
+	return ThreadPost{key: key, Post: p}
+}
+
+// Key implements TangledPost
+func (tp ThreadPost) Key() MessageRef { return tp.key }
+
+// Tangle implements TangledPost.
+// For the legacy form, a reply with a root but without a branch is treated as if it pointed to the root.
+func (tp ThreadPost) Tangle(name string) (*MessageRef, MessageRefs) {
+	if point, has := tp.Post.Tangles[name]; has {
+		return point.Root, point.Previous
+	}
+
+	if name != ThreadTangleName || tp.Post.Root == nil {
+		return nil, nil
+	}
+
+	if tp.knownBranch != nil {
+		return tp.Post.Root, tp.knownBranch
+	}
+	if len(tp.Post.Branch) == 0 {
+		return tp.Post.Root, MessageRefs{*tp.Post.Root}
+	}
+	return tp.Post.Root, tp.Post.Branch
+}
+
+// ThreadNode is a single post of a thread and the replies that are nested below it.
+type ThreadNode struct {
+	ThreadPost
+
+	// Depth is the nesting level, top-level replies have zero.
+	Depth int
+
+	Replies []*ThreadNode
+}
+
+// Thread is a sorted conversation, returned by BuildThread
+type Thread struct {
+	// Root is the first post of the thread, nil if it wasn't passed to BuildThread
+	Root *ThreadPost
+
+	// Sorted holds all the valid replies in causal order
+	Sorted []ThreadPost
+
+	// Replies holds the same posts as Sorted but nested by who replied to what.
+	Replies []*ThreadNode
+
+	// Report lists the posts that were not part of the thread
+	Report TangleReport
+}
+
+// BuildThread validates and sorts the passed posts into a thread that starts at root.
+//
+// Each reply is placed below the message it points to (if it points to multiple, the one that was sorted last is used).
+// A reply that is the only one to its parent continues the conversation on the same level,
+// if a post received more than one reply, they are nested below it.
+// Replies directly to the root are always top-level.
+//
+// Legacy posts often branch to messages the reader doesn't have. Those entries are ignored
+// and if none of the branches are known, the post is treated as a reply to the root.
+func BuildThread(root MessageRef, posts []ThreadPost) Thread {
+	known := make(map[MessageRef]struct{}, len(posts)+1)
+	known[root] = struct{}{}
+	for _, p := range posts {
+		known[p.Key()] = struct{}{}
+	}
+
+	tangled := make([]TangledPost, len(posts))
+	for i, p := range posts {
+		if _, isV2 := p.Post.Tangles[ThreadTangleName]; !isV2 && len(p.Post.Branch) > 0 {
+			p.knownBranch = MessageRefs{}
+			for _, b := range p.Post.Branch {
+				if _, has := known[b]; has {
+					p.knownBranch = append(p.knownBranch, b)
+				}
+			}
+			if len(p.knownBranch) == 0 {
+				p.knownBranch = MessageRefs{root}
+			}
+		}
+		tangled[i] = p
+	}
+
+	var t Thread
+	t.Report = ValidateTangle(root, ThreadTangleName, tangled)
+
+	valid := t.Report.Filter(tangled)
+
+	for i, p := range valid {
+		if p.Key().Equal(root) {
+			rootPost := valid[i].(ThreadPost)
+			t.Root = &rootPost
+			break
+		}
+	}
+
+	// replies are sorted by their longest path to the root and then by key, so that the output doesn't depend on the input order.
+	// ValidateTangle made sure that the posts form a DAG below the root, which lets threadDepths get away with a single pass.
+	depths := threadDepths(root, valid)
+	for _, p := range valid {
+		if !p.Key().Equal(root) {
+			t.Sorted = append(t.Sorted, p.(ThreadPost))
+		}
+	}
+	sort.Slice(t.Sorted, func(i, j int) bool {
+		a, b := t.Sorted[i].Key(), t.Sorted[j].Key()
+		if depths[a] != depths[b] {
+			return depths[a] < depths[b]
+		}
+		return a.String() < b.String()
+	})
+
+	// the root comes before all replies
+	position := make(map[MessageRef]int, len(t.Sorted)+1)
+	position[root] = 0
+	for i, p := range t.Sorted {
+		position[p.Key()] = i + 1
+	}
+
+	// find the parent of each reply
+	children := make(map[MessageRef][]ThreadPost)
+	for _, p := range t.Sorted {
+		_, prev := p.Tangle(ThreadTangleName)
+
+		parent := prev[0]
+		for _, candidate := range prev[1:] {
+			if position[candidate] > position[parent] {
+				parent = candidate
+			}
+		}
+		children[parent] = append(children[parent], p)
+	}
+
+	var place func(list *[]*ThreadNode, p ThreadPost, depth int)
+	place = func(list *[]*ThreadNode, p ThreadPost, depth int) {
+		node := &ThreadNode{ThreadPost: p, Depth: depth}
+		*list = append(*list, node)
+
+		replies := children[p.Key()]
+		if len(replies) == 1 {
+			place(list, replies[0], depth)
+			return
+		}
+		for _, r := range replies {
+			place(&node.Replies, r, depth+1)
+		}
+	}
+
+	for _, p := range children[root] {
+		place(&t.Replies, p, 0)
+	}
+
+	return t
+}
+
+// threadDepths returns the length of the longest path from each post to the root.
+// Every post is visited once, posts with multiple previous don't lead to walking the same paths again.
+func threadDepths(root MessageRef, posts []TangledPost) map[MessageRef]int {
+	prevs := make(map[MessageRef]MessageRefs, len(posts))
+	for _, p := range posts {
+		_, prev := p.Tangle(ThreadTangleName)
+		prevs[p.Key()] = prev
+	}
+
+	depths := make(map[MessageRef]int, len(posts)+1)
+	depths[root] = 0
+
+	var depth func(key MessageRef) int
+	depth = func(key MessageRef) int {
+		if d, has := depths[key]; has {
+			return d
+		}
+
+		d := 0
+		for _, p := range prevs[key] {
+			if _, has := prevs[p]; !has && !p.Equal(root) {
+				continue
+			}
+			if pd := depth(p) + 1; pd > d {
+				d = pd
+			}
+		}
+		depths[key] = d
+		return d
+	}
+
+	for _, p := range posts {
+		depth(p.Key())
+	}
+	return depths
+}
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildThread(t *testing.T) {
+	r := require.New(t)
+
+	key := func(s string) MessageRef {
+		mr := MessageRef{algo: RefAlgoMessageSSB1}
+		copy(mr.hash[:], s)
+		return mr
+	}
+	root := key("r0")
+
+	legacy := func(k string, branch ...string) ThreadPost {
+		p := NewPost(k)
+		p.Root = &root
+		for _, b := range branch {
+			p.Branch = append(p.Branch, key(b))
+		}
+		return NewThreadPost(key(k), p)
+	}
+
+	tangled := func(k string, prev ...string) ThreadPost {
+		p := NewPost(k)
+		tp := TanglePoint{Root: &root}
+		for _, b := range prev {
+			tp.Previous = append(tp.Previous, key(b))
+		}
+		p.Tangles = Tangles{"post": tp}
+		return NewThreadPost(key(k), p)
+	}
+
+	other := key("zz")
+	stray := NewPost("stray")
+	stray.Root = &other
+
+	posts := []ThreadPost{
+		NewThreadPost(root, NewPost("root")),
+		legacy("a1"),       // reply without branch
+		legacy("a2", "a1"), // only reply to a1, stays on the same level
+		tangled("b1", "a2"),
+		tangled("c1", "a2"),
+		legacy("b2", "b1"),
+		tangled("m1", "b2", "c1"), // merges both, b2 is deeper
+		NewThreadPost(key("x1"), stray),
+	}
+
+	for i := 0; i < 5; i++ {
+		rand.Shuffle(len(posts), func(i, j int) {
+			posts[i], posts[j] = posts[j], posts[i]
+		})
+
+		thread := BuildThread(root, posts)
+		r.NotNil(thread.Root)
+		r.Equal("root", thread.Root.Post.Text)
+		r.Len(thread.Report.Invalid, 1)
+
+		var sorted []string
+		for _, p := range thread.Sorted {
+			sorted = append(sorted, p.Post.Text)
+		}
+		r.Equal([]string{"a1", "a2", "b1", "c1", "b2", "m1"}, sorted)
+
+		r.Len(thread.Replies, 2)
+		r.Equal("a1", thread.Replies[0].Post.Text)
+		r.Equal("a2", thread.Replies[1].Post.Text)
+
+		nested := thread.Replies[1].Replies
+		var nestedTexts []string
+		for _, n := range nested {
+			r.Equal(1, n.Depth)
+			r.Empty(n.Replies)
+			nestedTexts = append(nestedTexts, n.Post.Text)
+		}
+		r.Equal([]string{"b1", "b2", "m1", "c1"}, nestedTexts)
+	}
+}
+
+func TestBuildThreadMissingRoot(t *testing.T) {
+	r := require.New(t)
+
+	var root MessageRef
+	root.algo = RefAlgoMessageSSB1
+	copy(root.hash[:], "r0")
+
+	reply := NewPost("reply")
+	reply.Root = &root
+
+	var replyKey MessageRef
+	replyKey.algo = RefAlgoMessageSSB1
+	copy(replyKey.hash[:], "a1")
+
+	thread := BuildThread(root, []ThreadPost{NewThreadPost(replyKey, reply)})
+	r.Nil(thread.Root)
+	r.Len(thread.Sorted, 1)
+	r.Len(thread.Replies, 1)
+	r.Equal("reply", thread.Replies[0].Post.Text)
+}
+
+func TestBuildThreadUnknownBranch(t *testing.T) {
+	r := require.New(t)
+
+	key := func(s string) MessageRef {
+		mr := MessageRef{algo: RefAlgoMessageSSB1}
+		copy(mr.hash[:], s)
+		return mr
+	}
+	root := key("r0")
+
+	legacy := func(k string, branch ...string) ThreadPost {
+		p := NewPost(k)
+		p.Root = &root
+		for _, b := range branch {
+			p.Branch = append(p.Branch, key(b))
+		}
+		return NewThreadPost(key(k), p)
+	}
+
+	posts := []ThreadPost{
+		NewThreadPost(root, NewPost("root")),
+		legacy("a1"),
+		legacy("b1"),
+		legacy("u1", "??"),             // only points to a message we don't have
+		legacy("u2", "a1", "??", "b1"), // points to known ones and an unknown one
+	}
+
+	thread := BuildThread(root, posts)
+	r.Empty(thread.Report.Invalid)
+	r.Len(thread.Sorted, 4)
+
+	// u1 is a reply to the root, u2 merges a1 and b1 and continues below b1, its only reply
+	var topLevel []string
+	for _, n := range thread.Replies {
+		r.Equal(0, n.Depth)
+		r.Empty(n.Replies)
+		topLevel = append(topLevel, n.Post.Text)
+	}
+	r.Equal([]string{"a1", "b1", "u2", "u1"}, topLevel)
+
+	// the branches of the post itself are left alone
+	for _, p := range thread.Sorted {
+		if p.Post.Text == "u2" {
+			r.Len(p.Post.Branch, 3)
+			_, prev := p.Tangle(ThreadTangleName)
+			r.Equal(MessageRefs{key("a1"), key("b1")}, prev)
+		}
+	}
+}
+
+func TestBuildThreadWideMerges(t *testing.T) {
+	r := require.New(t)
+
+	root := MessageRef{algo: RefAlgoMessageSSB1}
+	copy(root.hash[:], "root")
+
+	// 30 layers of 10 posts, each branching to every post of the layer before.
+	// Walking all paths to the root would take 10^30 steps.
+	const layers, width = 30, 10
+
+	var (
+		posts = []ThreadPost{NewThreadPost(root, NewPost("root"))}
+		prev  = MessageRefs{root}
+		layer = make(map[MessageRef]int)
+	)
+	for l := 0; l < layers; l++ {
+		var keys MessageRefs
+		for w := 0; w < width; w++ {
+			k := MessageRef{algo: RefAlgoMessageSSB1}
+			copy(k.hash[:], fmt.Sprintf("%02d-%02d", l, w))
+
+			p := NewPost(fmt.Sprintf("%d/%d", l, w))
+			p.Root = &root
+			p.Branch = prev
+			posts = append(posts, NewThreadPost(k, p))
+
+			keys = append(keys, k)
+			layer[k] = l
+		}
+		prev = keys
+	}
+
+	rand.Shuffle(len(posts), func(i, j int) {
+		posts[i], posts[j] = posts[j], posts[i]
+	})
+
+	done := make(chan Thread)
+	go func() { done <- BuildThread(root, posts) }()
+
+	var thread Thread
+	select {
+	case thread = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("BuildThread takes too long on a merge-heavy thread")
+	}
+
+	r.Empty(thread.Report.Invalid)
+	r.Len(thread.Sorted, layers*width)
+	for i := 1; i < len(thread.Sorted); i++ {
+		a, b := thread.Sorted[i-1].Key(), thread.Sorted[i].Key()
+		r.LessOrEqual(layer[a], layer[b], "position %d", i)
+		if layer[a] == layer[b] {
+			r.Less(a.String(), b.String(), "position %d", i)
+		}
+	}
+}
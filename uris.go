@@ -47,79 +47,187 @@ var (
 
 // ParseURI either returns a Canonical or an Experimental URI
 func ParseURI(input string) (URI, error) {
+	u, _, err := parseURI(input, false)
+	return u, err
+}
+
+// ParseURILenient is like ParseURI but also accepts canonical URIs that encode their data
+// as url-safe base64 without padding or as standard base64, where + and / might be percent-escaped.
+// normalized is true if the input was not in the canonical form, String() of the URI returns that form.
+func ParseURILenient(input string) (u URI, normalized bool, err error) {
+	return parseURI(input, true)
+}
+
+func parseURI(input string, lenient bool) (URI, bool, error) {
 	u, err := url.Parse(input)
 	if err != nil {
-		return nil, fmt.Errorf("url.Parse failed: %w", err)
+		return nil, false, fmt.Errorf("url.Parse failed: %w", err)
 	}
 
 	if u.Scheme != "ssb" {
-		return nil, ErrNotAnURI
+		return nil, false, ErrNotAnURI
 	}
 
-	if u.Opaque != "" {
-		return parseCaononicalURI(u.Opaque)
+	if u.Opaque == "experimental" {
+		return &ExperimentalURI{params: u.Query()}, false, nil
 	}
 
-	return &ExperimentalURI{params: u.Query()}, nil
+	c, normalized, err := parseCanonicalURL(input, u, lenient)
+	if err != nil {
+		return nil, false, err
+	}
+	return c, normalized, nil
+}
+
+// parseCanonicalURL parses an already split ssb: URL as a canonical URI.
+// Canonical URIs can't have a query or fragment, url.Parse would drop them from Opaque.
+func parseCanonicalURL(input string, u *url.URL, lenient bool) (CanonicalURI, bool, error) {
+	if u.RawQuery != "" || u.Fragment != "" || u.ForceQuery {
+		pos := strings.IndexAny(input, "?#")
+		return CanonicalURI{}, false, ErrInvalidCanonicalURI{Pos: pos, Segment: input[pos:], Reason: "unexpected query or fragment", Err: ErrNotACanonicalURI}
+	}
+
+	return parseCanonicalURIMode("ssb:"+u.Opaque, lenient)
+}
+
+// ErrInvalidCanonicalURI describes why a canonical URI was rejected.
+// Segment is the part of the input that was rejected and Pos is the byte offset of the problem in the parsed input.
+// Usually that is where Segment starts, but for invalid base64 Segment is the whole data and Pos points at the first corrupt character in it.
+// Err is one of ErrNotACanonicalURI, ErrInvalidRef, ErrInvalidRefAlgo, ErrInvalidHash or an ErrRefLen.
+type ErrInvalidCanonicalURI struct {
+	Pos     int
+	Segment string
+	Reason  string
+
+	Err error
+}
+
+func (e ErrInvalidCanonicalURI) Error() string {
+	return fmt.Sprintf("ssb-uri: %s at position %d (%q): %s", e.Reason, e.Pos, e.Segment, e.Err)
 }
 
+func (e ErrInvalidCanonicalURI) Unwrap() error { return e.Err }
+
+// parseCaononicalURI is the strict path for references that are passed as URIs.
 func parseCaononicalURI(input string) (CanonicalURI, error) {
+	if u, err := url.Parse(input); err == nil && u.Scheme == "ssb" {
+		c, _, err := parseCanonicalURL(input, u, false)
+		return c, err
+	}
+	c, _, err := parseCanonicalURIMode(input, false)
+	return c, err
+}
+
+func parseCanonicalURIMode(input string, lenient bool) (CanonicalURI, bool, error) {
 	var c CanonicalURI
 
-	parts := strings.Split(input, "/")
-	if len(parts) < 3 {
-		return c, ErrNotACanonicalURI
+	// offset of the current segment in input
+	pos := 0
+	if strings.HasPrefix(input, "ssb:") {
+		pos = 4
+	}
+	fail := func(segment, reason string, err error) (CanonicalURI, bool, error) {
+		return c, false, ErrInvalidCanonicalURI{Pos: pos, Segment: segment, Reason: reason, Err: err}
 	}
 
-	data, err := base64.URLEncoding.DecodeString(parts[2])
-	if err != nil {
-		return c, fmt.Errorf("ssb-uri: expected valid base64 url data: %w", err)
+	parts := strings.Split(input[pos:], "/")
+	if len(parts) < 3 {
+		return fail(input[pos:], "expected type/format/data", ErrNotACanonicalURI)
 	}
 
-	parts[0] = strings.TrimPrefix(parts[0], "ssb:")
+	typ, algo, encoded := parts[0], RefAlgo(parts[1]), parts[2]
 
-	switch parts[0] {
+	var validAlgo bool
+	switch typ {
 	case "message":
-		var r MessageRef
-		r.algo = RefAlgo(parts[1])
+		validAlgo = algo == RefAlgoMessageSSB1 || algo == RefAlgoMessageGabby || algo == RefAlgoMessageBendyButt
+	case "feed":
+		validAlgo = algo == RefAlgoFeedSSB1 || algo == RefAlgoFeedGabby || algo == RefAlgoFeedBendyButt
+	case "blob":
+		validAlgo = algo == RefAlgoBlobSSB1
+	default:
+		return fail(typ, "unknown type", ErrInvalidRef)
+	}
 
-		if !(r.algo == RefAlgoMessageSSB1 || r.algo == RefAlgoMessageGabby || r.algo == RefAlgoMessageBendyButt) {
-			return c, ErrInvalidRefAlgo
+	pos += len(typ) + 1
+	if !validAlgo {
+		return fail(string(algo), "unsupported format for "+typ, ErrInvalidRefAlgo)
+	}
+
+	pos += len(algo) + 1
+	if len(parts) > 3 {
+		trailing := strings.Join(parts[3:], "/")
+		pos += len(encoded)
+		return fail("/"+trailing, "unexpected trailing data", ErrNotACanonicalURI)
+	}
+
+	data, normalized, err := decodeCanonicalData(encoded, lenient)
+	if err != nil {
+		var corrupt base64.CorruptInputError
+		if errors.As(err, &corrupt) {
+			pos += int(corrupt)
 		}
+		return fail(encoded, err.Error(), ErrInvalidHash)
+	}
 
-		copy(r.hash[:], data)
+	if n := len(data); n != 32 {
+		return fail(encoded, "wrong data length", ErrRefLen{algo: algo, n: n})
+	}
 
+	switch typ {
+	case "message":
+		var r MessageRef
+		r.algo = algo
+		copy(r.hash[:], data)
 		c.ref = r
 
 	case "feed":
 		var r FeedRef
-		r.algo = RefAlgo(parts[1])
-
-		if !(r.algo == RefAlgoFeedSSB1 || r.algo == RefAlgoFeedGabby || r.algo == RefAlgoFeedBendyButt) {
-			return c, ErrInvalidRefAlgo
-		}
-
+		r.algo = algo
 		copy(r.id[:], data)
-
 		c.ref = r
 
 	case "blob":
 		var r BlobRef
-		r.algo = RefAlgo(parts[1])
+		r.algo = algo
+		copy(r.hash[:], data)
+		c.ref = r
+	}
 
-		if r.algo != RefAlgoBlobSSB1 {
-			return c, ErrInvalidRefAlgo
-		}
+	return c, normalized, nil
+}
 
-		copy(r.hash[:], data)
+// decodeCanonicalData only accepts padded, url-safe base64 without line breaks or stray bits.
+// In lenient mode it also tries to unescape the data and to decode it without padding and with the standard alphabet.
+func decodeCanonicalData(encoded string, lenient bool) ([]byte, bool, error) {
+	if i := strings.IndexAny(encoded, "\r\n"); i >= 0 {
+		return nil, false, base64.CorruptInputError(i)
+	}
 
-		c.ref = r
-	default:
+	data, err := base64.URLEncoding.Strict().DecodeString(encoded)
+	if err == nil || !lenient {
+		return data, false, err
+	}
 
-		return c, ErrInvalidRef
+	unescaped, uerr := url.PathUnescape(encoded)
+	if uerr != nil {
+		return nil, false, err
 	}
 
-	return c, nil
+	// map the standard alphabet to the url-safe one and drop the padding
+	normalized := strings.NewReplacer("+", "-", "/", "_").Replace(unescaped)
+	normalized = strings.TrimRight(normalized, "=")
+
+	if strings.ContainsAny(normalized, "\r\n") {
+		return nil, false, err
+	}
+
+	data, lerr := base64.RawURLEncoding.Strict().DecodeString(normalized)
+	if lerr != nil {
+		// report the error of the canonical form
+		return nil, false, err
+	}
+	return data, true, nil
 }
 
 // CanonicalURI currently defines 3 different kinds of URIs for Messages, Feeds and Blobs
@@ -209,8 +317,8 @@ func (e ExperimentalURI) String() string {
 	u.Scheme = "ssb"
 	u.Opaque = "experimental"
 
-	if e.lazyCanonical != nil {
-		e.params.Add("ref", e.lazyCanonical.ref.Sigil())
+	if e.lazyCanonical != nil && e.params.Get("ref") == "" {
+		e.params.Set("ref", e.lazyCanonical.ref.Sigil())
 	}
 
 	u.RawQuery = e.params.Encode()
@@ -235,13 +343,14 @@ func (e *ExperimentalURI) tryCanonicalRef() error {
 		return ErrNotACanonicalURI
 	}
 
-	c, err := parseCaononicalURI(strings.TrimPrefix(ref, "ssb:"))
+	// the spec uses canonical URIs but older versions of this package used sigils
+	r, err := ParseRef(ref)
 	if err != nil {
 		e.lazyErr = err
 		return ErrNotACanonicalURI
 	}
 
-	e.lazyCanonical = &c
+	e.lazyCanonical = &CanonicalURI{ref: r}
 	return nil
 }
 
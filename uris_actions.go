@@ -0,0 +1,471 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// The actions of experimental URIs, as defined by https://github.com/ssb-ngi-pointer/ssb-uri-spec
+const (
+	ActionAddPub          = "add-pub"
+	ActionJoinRoom        = "join-room"
+	ActionConsumeAlias    = "consume-alias"
+	ActionStartHTTPAuth   = "start-http-auth"
+	ActionClaimHTTPInvite = "claim-http-invite"
+	ActionFollow          = "follow"
+	ActionOpenMessage     = "open-message"
+	ActionOpenFeed        = "open-feed"
+	ActionOpenBlob        = "open-blob"
+)
+
+// ErrUnknownAction is returned by ParseExperimentalAction if the action is not one of the Action* constants
+var ErrUnknownAction = errors.New("ssb-uri: unknown experimental action")
+
+// ErrMissingParam is returned if an experimental URI lacks a parameter its action requires
+type ErrMissingParam struct {
+	Action, Param string
+}
+
+func (e ErrMissingParam) Error() string {
+	return fmt.Sprintf("ssb-uri: action %s needs parameter %q", e.Action, e.Param)
+}
+
+// ErrInvalidParam is returned if a parameter of an experimental URI is present but not usable
+type ErrInvalidParam struct {
+	Action, Param string
+
+	Err error
+}
+
+func (e ErrInvalidParam) Error() string {
+	return fmt.Sprintf("ssb-uri: action %s: invalid parameter %q: %s", e.Action, e.Param, e.Err)
+}
+
+func (e ErrInvalidParam) Unwrap() error { return e.Err }
+
+// Is reports whether target is an ErrInvalidParam for the same action and parameter, regardless of the cause.
+func (e ErrInvalidParam) Is(target error) bool {
+	other, ok := target.(ErrInvalidParam)
+	return ok && other.Action == e.Action && other.Param == e.Param
+}
+
+// ExperimentalAction is the typed form of an experimental URI.
+// Use ParseExperimentalAction or (*ExperimentalURI).Action() to get one
+// and type-switch on the *Action types of this package.
+type ExperimentalAction interface {
+	fmt.Stringer
+
+	// Action returns the value of the action parameter
+	Action() string
+
+	// Values returns all the parameters of the URI, including action
+	Values() url.Values
+}
+
+// ParseExperimentalAction parses an experimental URI and returns its typed action.
+func ParseExperimentalAction(input string) (ExperimentalAction, error) {
+	u, err := ParseURI(input)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := u.(*ExperimentalURI)
+	if !ok {
+		return nil, fmt.Errorf("ssb-uri: not an experimental URI: %w", ErrUnknownAction)
+	}
+	return e.Action()
+}
+
+// Action returns the typed action of the URI and checks that the required parameters are present.
+func (e *ExperimentalURI) Action() (ExperimentalAction, error) {
+	p := actionParams{action: e.params.Get("action"), vals: e.params}
+
+	var a ExperimentalAction
+	switch p.action {
+	case ActionAddPub:
+		a = AddPubAction{
+			MultiserverAddress: p.msaddr(),
+		}
+
+	case ActionJoinRoom:
+		a = JoinRoomAction{
+			Invite:             p.required("invite"),
+			MultiserverAddress: p.msaddr(),
+		}
+
+	case ActionConsumeAlias:
+		a = ConsumeAliasAction{
+			RoomID:             p.feed("roomId", "roomID"),
+			UserID:             p.feed("userId", "userID"),
+			Alias:              p.required("alias"),
+			Signature:          p.required("signature"),
+			MultiserverAddress: p.msaddr(),
+		}
+
+	case ActionStartHTTPAuth:
+		a = StartHTTPAuthAction{
+			ServerID:           p.feed("sid"),
+			Challenge:          p.challenge("sc"),
+			Invite:             p.optional("invite"),
+			MultiserverAddress: p.optionalMSAddr(),
+		}
+
+	case ActionClaimHTTPInvite:
+		a = ClaimHTTPInviteAction{
+			Invite: p.required("invite"),
+			PostTo: p.httpURL("postTo"),
+		}
+
+	case ActionFollow:
+		a = FollowAction{Feed: p.feed("ref")}
+
+	case ActionOpenFeed:
+		a = OpenFeedAction{Feed: p.feed("ref")}
+
+	case ActionOpenMessage:
+		a = OpenMessageAction{Message: p.message("ref")}
+
+	case ActionOpenBlob:
+		a = OpenBlobAction{Blob: p.blob("ref")}
+
+	case "":
+		return nil, ErrMissingParam{Action: "experimental", Param: "action"}
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAction, p.action)
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return a, nil
+}
+
+// actionParams helps to collect the parameters of an action and remembers the first error.
+// The first name is the one of the spec, which this package writes. The others are older names that are still accepted.
+type actionParams struct {
+	action string
+	vals   url.Values
+	err    error
+}
+
+func (p *actionParams) optional(names ...string) string {
+	for _, n := range names {
+		if v := p.vals.Get(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (p *actionParams) required(names ...string) string {
+	v := p.optional(names...)
+	if v == "" && p.err == nil {
+		p.err = ErrMissingParam{Action: p.action, Param: names[0]}
+	}
+	return v
+}
+
+func (p *actionParams) msaddr() MultiserverAddress {
+	v := p.required("multiserverAddress", "msaddr")
+	if v == "" {
+		return MultiserverAddress{}
+	}
+	return p.parseMSAddr(v)
+}
+
+func (p *actionParams) optionalMSAddr() *MultiserverAddress {
+	v := p.optional("multiserverAddress", "msaddr")
+	if v == "" {
+		return nil
+	}
+	ma := p.parseMSAddr(v)
+	return &ma
+}
+
+func (p *actionParams) parseMSAddr(v string) MultiserverAddress {
+	ma, err := ParseMultiserverAddress(v)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("ssb-uri: action %s: %w", p.action, err)
+	}
+	return ma
+}
+
+func (p *actionParams) invalid(name string, err error) {
+	if p.err == nil {
+		p.err = ErrInvalidParam{Action: p.action, Param: name, Err: err}
+	}
+}
+
+func (p *actionParams) challenge(name string) string {
+	v := p.required(name)
+	if v == "" {
+		return ""
+	}
+	if _, err := DecodeHTTPAuthChallenge(v); err != nil {
+		p.invalid(name, err)
+	}
+	return v
+}
+
+func (p *actionParams) httpURL(name string) string {
+	v := p.required(name)
+	if v == "" {
+		return ""
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		p.invalid(name, err)
+		return v
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.invalid(name, fmt.Errorf("not an absolute http(s) URL: %q", v))
+	}
+	return v
+}
+
+func (p *actionParams) ref(name string) Ref {
+	v := p.required(name)
+	if v == "" {
+		return nil
+	}
+	r, err := ParseRef(v)
+	if err != nil {
+		if p.err == nil {
+			p.err = fmt.Errorf("ssb-uri: action %s: invalid %s: %w", p.action, name, err)
+		}
+		return nil
+	}
+	return r
+}
+
+func (p *actionParams) feed(names ...string) FeedRef {
+	v := p.required(names...)
+	if v == "" {
+		return FeedRef{}
+	}
+	fr, err := ParseFeedRef(v)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("ssb-uri: action %s: invalid %s: %w", p.action, names[0], err)
+	}
+	return fr
+}
+
+func (p *actionParams) message(name string) MessageRef {
+	r := p.ref(name)
+	if r == nil {
+		return MessageRef{}
+	}
+	mr, ok := r.(MessageRef)
+	if !ok && p.err == nil {
+		p.err = fmt.Errorf("ssb-uri: action %s: %s is not a message: %w", p.action, name, ErrInvalidRefType)
+	}
+	return mr
+}
+
+func (p *actionParams) blob(name string) BlobRef {
+	r := p.ref(name)
+	if r == nil {
+		return BlobRef{}
+	}
+	br, ok := r.(BlobRef)
+	if !ok && p.err == nil {
+		p.err = fmt.Errorf("ssb-uri: action %s: %s is not a blob: %w", p.action, name, ErrInvalidRefType)
+	}
+	return br
+}
+
+// WithAction sets all the parameters of the passed action on the URI.
+func WithAction(a ExperimentalAction) URIOption {
+	return func(e *ExperimentalURI) error {
+		for k, vs := range a.Values() {
+			e.params[k] = vs
+		}
+		return nil
+	}
+}
+
+func actionURI(a ExperimentalAction) string {
+	var u url.URL
+	u.Scheme = "ssb"
+	u.Opaque = "experimental"
+	u.RawQuery = a.Values().Encode()
+	return u.String()
+}
+
+func newActionValues(action string, kv ...string) url.Values {
+	v := url.Values{"action": []string{action}}
+	for i := 0; i < len(kv); i += 2 {
+		if kv[i+1] == "" {
+			continue
+		}
+		v.Set(kv[i], kv[i+1])
+	}
+	return v
+}
+
+// AddPubAction tells the client to connect to a pub and follow it
+type AddPubAction struct {
+	MultiserverAddress MultiserverAddress
+}
+
+// Action implements ExperimentalAction
+func (AddPubAction) Action() string { return ActionAddPub }
+
+// Values implements ExperimentalAction
+func (a AddPubAction) Values() url.Values {
+	return newActionValues(ActionAddPub, "multiserverAddress", a.MultiserverAddress.String())
+}
+
+func (a AddPubAction) String() string { return actionURI(a) }
+
+// JoinRoomAction tells the client to accept an invite to a rooms2 server
+type JoinRoomAction struct {
+	Invite             string
+	MultiserverAddress MultiserverAddress
+}
+
+// Action implements ExperimentalAction
+func (JoinRoomAction) Action() string { return ActionJoinRoom }
+
+// Values implements ExperimentalAction
+func (a JoinRoomAction) Values() url.Values {
+	return newActionValues(ActionJoinRoom, "invite", a.Invite, "multiserverAddress", a.MultiserverAddress.String())
+}
+
+func (a JoinRoomAction) String() string { return actionURI(a) }
+
+// ConsumeAliasAction tells the client to connect to the user behind an alias on a rooms2 server
+type ConsumeAliasAction struct {
+	RoomID, UserID FeedRef
+
+	Alias     string
+	Signature string
+
+	MultiserverAddress MultiserverAddress
+}
+
+// Action implements ExperimentalAction
+func (ConsumeAliasAction) Action() string { return ActionConsumeAlias }
+
+// Values implements ExperimentalAction
+func (a ConsumeAliasAction) Values() url.Values {
+	return newActionValues(ActionConsumeAlias,
+		"roomId", a.RoomID.String(),
+		"userId", a.UserID.String(),
+		"alias", a.Alias,
+		"signature", a.Signature,
+		"multiserverAddress", a.MultiserverAddress.String(),
+	)
+}
+
+func (a ConsumeAliasAction) String() string { return actionURI(a) }
+
+// StartHTTPAuthAction tells the client to sign into a rooms2 server with the passed challenge
+type StartHTTPAuthAction struct {
+	ServerID  FeedRef
+	Challenge string
+
+	// optional
+	Invite             string
+	MultiserverAddress *MultiserverAddress
+}
+
+// Action implements ExperimentalAction
+func (StartHTTPAuthAction) Action() string { return ActionStartHTTPAuth }
+
+// Values implements ExperimentalAction
+func (a StartHTTPAuthAction) Values() url.Values {
+	var msaddr string
+	if a.MultiserverAddress != nil {
+		msaddr = a.MultiserverAddress.String()
+	}
+	return newActionValues(ActionStartHTTPAuth,
+		"sid", a.ServerID.String(),
+		"sc", a.Challenge,
+		"invite", a.Invite,
+		"multiserverAddress", msaddr,
+	)
+}
+
+func (a StartHTTPAuthAction) String() string { return actionURI(a) }
+
+// ClaimHTTPInviteAction tells the client to claim an invite by posting its ID to a rooms2 server
+type ClaimHTTPInviteAction struct {
+	Invite string
+	PostTo string
+}
+
+// Action implements ExperimentalAction
+func (ClaimHTTPInviteAction) Action() string { return ActionClaimHTTPInvite }
+
+// Values implements ExperimentalAction
+func (a ClaimHTTPInviteAction) Values() url.Values {
+	return newActionValues(ActionClaimHTTPInvite, "invite", a.Invite, "postTo", a.PostTo)
+}
+
+func (a ClaimHTTPInviteAction) String() string { return actionURI(a) }
+
+// FollowAction asks the client to follow a feed
+type FollowAction struct {
+	Feed FeedRef
+}
+
+// Action implements ExperimentalAction
+func (FollowAction) Action() string { return ActionFollow }
+
+// Values implements ExperimentalAction
+func (a FollowAction) Values() url.Values {
+	return newActionValues(ActionFollow, "ref", a.Feed.URI())
+}
+
+func (a FollowAction) String() string { return actionURI(a) }
+
+// OpenFeedAction asks the client to show a feed
+type OpenFeedAction struct {
+	Feed FeedRef
+}
+
+// Action implements ExperimentalAction
+func (OpenFeedAction) Action() string { return ActionOpenFeed }
+
+// Values implements ExperimentalAction
+func (a OpenFeedAction) Values() url.Values {
+	return newActionValues(ActionOpenFeed, "ref", a.Feed.URI())
+}
+
+func (a OpenFeedAction) String() string { return actionURI(a) }
+
+// OpenMessageAction asks the client to show a message
+type OpenMessageAction struct {
+	Message MessageRef
+}
+
+// Action implements ExperimentalAction
+func (OpenMessageAction) Action() string { return ActionOpenMessage }
+
+// Values implements ExperimentalAction
+func (a OpenMessageAction) Values() url.Values {
+	return newActionValues(ActionOpenMessage, "ref", a.Message.URI())
+}
+
+func (a OpenMessageAction) String() string { return actionURI(a) }
+
+// OpenBlobAction asks the client to show a blob
+type OpenBlobAction struct {
+	Blob BlobRef
+}
+
+// Action implements ExperimentalAction
+func (OpenBlobAction) Action() string { return ActionOpenBlob }
+
+// Values implements ExperimentalAction
+func (a OpenBlobAction) Values() url.Values {
+	return newActionValues(ActionOpenBlob, "ref", a.Blob.URI())
+}
+
+func (a OpenBlobAction) String() string { return actionURI(a) }
@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExperimentalActionsRoundtrip(t *testing.T) {
+	var (
+		feedA, feedB FeedRef
+		msg          MessageRef
+		blob         BlobRef
+	)
+	feedA.algo, feedB.algo = RefAlgoFeedSSB1, RefAlgoFeedSSB1
+	copy(feedA.id[:], bytes.Repeat([]byte("A"), 32))
+	copy(feedB.id[:], bytes.Repeat([]byte("B"), 32))
+	msg.algo = RefAlgoMessageSSB1
+	copy(msg.hash[:], bytes.Repeat([]byte("M"), 32))
+	blob.algo = RefAlgoBlobSSB1
+	copy(blob.hash[:], bytes.Repeat([]byte("b"), 32))
+
+	msaddr, err := NewNetMultiserverAddress("room.example:8008", feedA.PubKey())
+	require.NoError(t, err)
+
+	challenge := base64.URLEncoding.EncodeToString(bytes.Repeat([]byte("c"), 32))
+
+	var actions = []ExperimentalAction{
+		AddPubAction{MultiserverAddress: msaddr},
+		JoinRoomAction{Invite: "some-code", MultiserverAddress: msaddr},
+		ConsumeAliasAction{RoomID: feedA, UserID: feedB, Alias: "bob", Signature: "c2lnbmF0dXJl.sig.ed25519", MultiserverAddress: msaddr},
+		StartHTTPAuthAction{ServerID: feedA, Challenge: challenge},
+		StartHTTPAuthAction{ServerID: feedA, Challenge: challenge, Invite: "code", MultiserverAddress: &msaddr},
+		ClaimHTTPInviteAction{Invite: "code", PostTo: "https://room.example/invite/consume"},
+		FollowAction{Feed: feedB},
+		OpenFeedAction{Feed: feedB},
+		OpenMessageAction{Message: msg},
+		OpenBlobAction{Blob: blob},
+	}
+
+	for _, a := range actions {
+		t.Run(a.Action(), func(t *testing.T) {
+			r := require.New(t)
+
+			uri := a.String()
+			got, err := ParseExperimentalAction(uri)
+			r.NoError(err, uri)
+			r.Equal(a, got)
+			r.Equal(uri, got.String())
+
+			built, err := NewExperimentalURI(WithAction(a))
+			r.NoError(err)
+			r.Equal(uri, built.String())
+		})
+	}
+}
+
+func TestExperimentalActionsInvalid(t *testing.T) {
+	var cases = []struct {
+		input string
+		err   error
+	}{
+		{"ssb:experimental?foo=bar", ErrMissingParam{Action: "experimental", Param: "action"}},
+		{"ssb:experimental?action=fly", ErrUnknownAction},
+		{"ssb:experimental?action=add-pub", ErrMissingParam{Action: ActionAddPub, Param: "multiserverAddress"}},
+		{"ssb:experimental?action=join-room&msaddr=net%3Ahost%3A8008", ErrMissingParam{Action: ActionJoinRoom, Param: "invite"}},
+		{"ssb:experimental?action=claim-http-invite&invite=code", ErrMissingParam{Action: ActionClaimHTTPInvite, Param: "postTo"}},
+		{"ssb:experimental?action=start-http-auth&sc=challenge", ErrMissingParam{Action: ActionStartHTTPAuth, Param: "sid"}},
+		{"ssb:experimental?action=claim-http-invite&invite=code&postTo=ftp%3A%2F%2Froom.example", ErrInvalidParam{Action: ActionClaimHTTPInvite, Param: "postTo"}},
+		{"ssb:experimental?action=claim-http-invite&invite=code&postTo=%2Finvite%2Fconsume", ErrInvalidParam{Action: ActionClaimHTTPInvite, Param: "postTo"}},
+		{"ssb:experimental?action=start-http-auth&sid=%40%2BoaWWDs8g73EZFUMfW37R%2FULtFEjwKN%2FDczvdYihjbU%3D.ed25519&sc=c2hvcnQ%3D", ErrInvalidHTTPAuthChallenge},
+		{"ssb:experimental?action=follow&ref=nope", ErrInvalidRef},
+		{"ssb:experimental?action=add-pub&msaddr=net%3Ahost", ErrInvalidMultiserverAddress},
+		{"ssb:experimental?action=open-message&ref=ssb%3Afeed%2Fed25519%2F-oaWWDs8g73EZFUMfW37R_ULtFEjwKN_DczvdYihjbU%3D", ErrInvalidRefType},
+		{"ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w=", ErrUnknownAction},
+	}
+
+	for i, tc := range cases {
+		_, err := ParseExperimentalAction(tc.input)
+		require.Error(t, err, "case %d", i)
+		require.True(t, errors.Is(err, tc.err), "case %d: %s", i, err)
+	}
+}
+
+func TestExperimentalActionsSpecParams(t *testing.T) {
+	r := require.New(t)
+
+	input := "ssb:experimental?action=consume-alias&alias=bob" +
+		"&roomId=%40%2BoaWWDs8g73EZFUMfW37R%2FULtFEjwKN%2FDczvdYihjbU%3D.ed25519" +
+		"&userId=%40ye%2BQM09iPcDJD6YvQYjoQc7sLF%2FIFhmNbEqgdzQo3lQ%3D.ed25519" +
+		"&signature=sig&multiserverAddress=net%3Ahost%3A8008"
+
+	a, err := ParseExperimentalAction(input)
+	r.NoError(err)
+
+	ca, ok := a.(ConsumeAliasAction)
+	r.True(ok, "wrong type %T", a)
+	r.Equal("bob", ca.Alias)
+	r.Equal("@+oaWWDs8g73EZFUMfW37R/ULtFEjwKN/DczvdYihjbU=.ed25519", ca.RoomID.String())
+	r.Equal("@ye+QM09iPcDJD6YvQYjoQc7sLF/IFhmNbEqgdzQo3lQ=.ed25519", ca.UserID.String())
+	r.Equal("net:host:8008", ca.MultiserverAddress.String())
+
+	// the names of older versions of this package are still accepted
+	legacy := "ssb:experimental?action=consume-alias&alias=bob" +
+		"&roomID=%40%2BoaWWDs8g73EZFUMfW37R%2FULtFEjwKN%2FDczvdYihjbU%3D.ed25519" +
+		"&userID=%40ye%2BQM09iPcDJD6YvQYjoQc7sLF%2FIFhmNbEqgdzQo3lQ%3D.ed25519" +
+		"&signature=sig&msaddr=net%3Ahost%3A8008"
+
+	a, err = ParseExperimentalAction(legacy)
+	r.NoError(err)
+	r.Equal(ca, a)
+
+	// but only the spec names are written
+	out := a.Values()
+	for _, name := range []string{"roomId", "userId", "multiserverAddress"} {
+		r.NotEmpty(out.Get(name), name)
+	}
+	for _, name := range []string{"roomID", "userID", "msaddr"} {
+		r.Empty(out.Get(name), name)
+	}
+}
+
+func TestExperimentalURIStringStable(t *testing.T) {
+	r := require.New(t)
+
+	input := "ssb:experimental?action=open-message&ref=ssb%3Amessage%2Fsha256%2Fg3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w%3D"
+	u, err := ParseURI(input)
+	r.NoError(err)
+	r.Equal(KindMessage, u.Kind())
+
+	r.Equal(input, u.String())
+	r.Equal(input, u.String(), "calling String() twice should not change the URI")
+}
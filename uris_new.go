@@ -5,9 +5,7 @@
 package refs
 
 import (
-	"encoding/base64"
 	"fmt"
-	"net"
 	"net/url"
 
 	"golang.org/x/crypto/ed25519"
@@ -16,18 +14,29 @@ import (
 // URIOption allow to customaize an experimental ssb-uri
 type URIOption func(e *ExperimentalURI) error
 
-// MSAddr adds a multiserver address to an experimental URI
+// MSAddr adds a multiserver address to an experimental URI.
+// hostAndPort needs a numeric port, anything NewNetMultiserverAddress can't parse is rejected.
 func MSAddr(hostAndPort string, pubKey ed25519.PublicKey) URIOption {
-	return func(e *ExperimentalURI) error {
+	return MSAddrWithSeed(hostAndPort, pubKey, nil)
+}
 
-		host, port, err := net.SplitHostPort(hostAndPort)
+// MSAddrWithSeed is like MSAddr but puts the seed of a legacy pub invite into the shs transform (net:host:port~shs:key:seed).
+// The seed is optional, without it the address is the same as the one of MSAddr.
+func MSAddrWithSeed(hostAndPort string, pubKey ed25519.PublicKey, seed []byte) URIOption {
+	return func(e *ExperimentalURI) error {
+		msAddr, err := NewNetMultiserverAddress(hostAndPort, pubKey)
 		if err != nil {
 			return err
 		}
 
-		// cant import go.mindeco.de/ssb-multiserver
-		msAddr := fmt.Sprintf("net:%s:%s~shs:%s", host, port, base64.StdEncoding.EncodeToString(pubKey))
-		e.params.Set("msaddr", msAddr)
+		if seed != nil {
+			if n := len(seed); n != ed25519.SeedSize {
+				return fmt.Errorf("seed has wrong length %d", n)
+			}
+			msAddr.Transforms[0].Seed = seed
+		}
+
+		e.params.Set("multiserverAddress", msAddr.String())
 		e.params.Set("action", "add-pub")
 		return nil
 	}
@@ -42,11 +51,46 @@ func RoomInvite(code string) URIOption {
 	}
 }
 
+// HTTPInvite adds a rooms2 invite that is claimed by posting it to postTo
+func HTTPInvite(code, postTo string) URIOption {
+	return func(e *ExperimentalURI) error {
+		u, err := url.Parse(postTo)
+		if err != nil {
+			return err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("postTo is not an absolute http(s) URL: %q", postTo)
+		}
+
+		e.params.Set("invite", code)
+		e.params.Set("postTo", postTo)
+		e.params.Set("action", "claim-http-invite")
+		return nil
+	}
+}
+
+// HTTPAuth adds the challenge of a rooms2 server to sign in over HTTP.
+// Use NewHTTPAuthChallenge to create the challenge.
+func HTTPAuth(serverID FeedRef, challenge string) URIOption {
+	return func(e *ExperimentalURI) error {
+		if _, err := DecodeHTTPAuthChallenge(challenge); err != nil {
+			return err
+		}
+
+		e.params.Set("sid", serverID.String())
+		e.params.Set("sc", challenge)
+		e.params.Set("action", "start-http-auth")
+		return nil
+	}
+}
+
 // RoomAlias adds a rooms2 alias to an experimental URI
 func RoomAlias(roomID, userID, alias, signature string) URIOption {
 	return func(e *ExperimentalURI) error {
-		e.params.Set("roomID", roomID)
-		e.params.Set("userID", userID)
+		e.params.Set("roomId", roomID)
+		e.params.Set("userId", userID)
+		e.params.Set("alias", alias)
+		e.params.Set("signature", signature)
 		e.params.Set("action", "consume-alias")
 		return nil
 	}
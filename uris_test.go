@@ -6,6 +6,7 @@ package refs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"testing"
@@ -136,7 +137,7 @@ func ExampleNewExperimentalURI() {
 
 	// msaddr
 	msaddr, err := NewExperimentalURI(
-		MSAddr("host:port", testRef.PubKey()),
+		MSAddr("host:8008", testRef.PubKey()),
 	)
 	check(err)
 	fmt.Println("simple multiserver address:")
@@ -144,7 +145,7 @@ func ExampleNewExperimentalURI() {
 
 	// room invite
 	roomInvite, err := NewExperimentalURI(
-		MSAddr("host:port", testRef.PubKey()),
+		MSAddr("host:8008", testRef.PubKey()),
 		RoomInvite("some-code"),
 	)
 	check(err)
@@ -153,7 +154,7 @@ func ExampleNewExperimentalURI() {
 
 	// room alias
 	roomAlias, err := NewExperimentalURI(
-		MSAddr("host:port", testRef.PubKey()),
+		MSAddr("host:8008", testRef.PubKey()),
 		RoomAlias("roomID", "userID", "alias", "sig"),
 	)
 	check(err)
@@ -162,9 +163,160 @@ func ExampleNewExperimentalURI() {
 
 	// Output:
 	// simple multiserver address:
-	// ssb:experimental?action=add-pub&msaddr=net%3Ahost%3Aport~shs%3AQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE%3D
+	// ssb:experimental?action=add-pub&multiserverAddress=net%3Ahost%3A8008~shs%3AQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE%3D
 	// rooms2 invite:
-	// ssb:experimental?action=join-room&invite=some-code&msaddr=net%3Ahost%3Aport~shs%3AQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE%3D
+	// ssb:experimental?action=join-room&invite=some-code&multiserverAddress=net%3Ahost%3A8008~shs%3AQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE%3D
 	// rooms2 alias:
-	// ssb:experimental?action=consume-alias&msaddr=net%3Ahost%3Aport~shs%3AQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE%3D&roomID=roomID&userID=userID
+	// ssb:experimental?action=consume-alias&alias=alias&multiserverAddress=net%3Ahost%3A8008~shs%3AQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE%3D&roomId=roomID&signature=sig&userId=userID
+}
+
+// TestMSAddrNeedsPort pins that MSAddr validates its input since it uses MultiserverAddress.
+// It used to format anything, like "host:port", into the URI.
+func TestMSAddrNeedsPort(t *testing.T) {
+	r := require.New(t)
+
+	var testRef FeedRef
+	copy(testRef.id[:], bytes.Repeat([]byte("A"), 32))
+
+	for _, input := range []string{"host:port", "host", "host:99999"} {
+		_, err := NewExperimentalURI(MSAddr(input, testRef.PubKey()))
+		r.Error(err, input)
+	}
+
+	u, err := NewExperimentalURI(MSAddr("host:8008", testRef.PubKey()))
+	r.NoError(err)
+	r.Contains(u.String(), "net%3Ahost%3A8008~shs")
+}
+
+func TestParseCanonicalURIStrict(t *testing.T) {
+	type tcase struct {
+		input string
+
+		pos     int
+		segment string
+		err     error
+	}
+
+	var cases = []tcase{
+		{"ssb:message", 4, "message", ErrNotACanonicalURI},
+		{"ssb:thing/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w=", 4, "thing", ErrInvalidRef},
+		{"ssb:message/sha512/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w=", 12, "sha512", ErrInvalidRefAlgo},
+		{"ssb:blob/ed25519/sbBmsB7XWvmIzkBzreYcuzPpLtpeCMDIs6n_OJGSC1U=", 9, "ed25519", ErrInvalidRefAlgo},
+
+		// short data used to become a zero-padded ref
+		{"ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2Ng==", 19, "g3hPVPDEO1Aj_uPl0-J2Ng==", ErrRefLen{algo: RefAlgoMessageSSB1, n: 16}},
+		{"ssb:feed/ed25519/", 17, "", ErrRefLen{algo: RefAlgoFeedSSB1, n: 0}},
+
+		// trailing parts
+		{"ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w=/", 63, "/", ErrNotACanonicalURI},
+		{"ssb:blob/sha256/sbBmsB7XWvmIzkBzreYcuzPpLtpeCMDIs6n_OJGSC1U=/extra/parts", 60, "/extra/parts", ErrNotACanonicalURI},
+		{"ssb:blob/sha256/sbBmsB7XWvmIzkBzreYcuzPpLtpeCMDIs6n_OJGSC1U=?foo=bar", 60, "?foo=bar", ErrNotACanonicalURI},
+		{"ssb:blob/sha256/sbBmsB7XWvmIzkBzreYcuzPpLtpeCMDIs6n_OJGSC1U=#top", 60, "#top", ErrNotACanonicalURI},
+
+		// bad padding and encoding
+		{"ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w", 59, "g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w", ErrInvalidHash},
+		{"ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3x=", 62, "g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3x=", ErrInvalidHash},
+		{"ssb:message/sha256/g3hPVPDEO1Aj/uPl0+J2NlhFB2bbFLIHlty+YuqFZ3w=", 31, "/uPl0+J2NlhFB2bbFLIHlty+YuqFZ3w=", ErrNotACanonicalURI},
+		{"ssb:message/sha256/g3hPVPDEO1Aj_uPl0+J2NlhFB2bbFLIHlty-YuqFZ3w=", 36, "g3hPVPDEO1Aj_uPl0+J2NlhFB2bbFLIHlty-YuqFZ3w=", ErrInvalidHash},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			r := require.New(t)
+
+			_, err := ParseURI(tc.input)
+			r.Error(err)
+
+			var uriErr ErrInvalidCanonicalURI
+			r.True(errors.As(err, &uriErr), "wrong error type %T: %s", err, err)
+			r.Equal(tc.pos, uriErr.Pos, "wrong position: %s", err)
+			r.Equal(tc.segment, uriErr.Segment)
+			r.True(errors.Is(err, tc.err), "wrong cause: %s", err)
+		})
+	}
+}
+
+// TestParseRefURIStrict makes sure the ref parsers take the same strict path as ParseURI
+func TestParseRefURIStrict(t *testing.T) {
+	r := require.New(t)
+
+	const (
+		msg  = "ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w="
+		feed = "ssb:feed/ed25519/-oaWWDs8g73EZFUMfW37R_ULtFEjwKN_DczvdYihjbU="
+	)
+
+	for _, suffix := range []string{"?foo=bar#x", "?foo=bar", "#x", "?"} {
+		_, err := ParseRef(msg + suffix)
+		r.True(errors.Is(err, ErrNotACanonicalURI), "ParseRef %s: %v", suffix, err)
+
+		_, err = ParseMessageRef(msg + suffix)
+		r.True(errors.Is(err, ErrNotACanonicalURI), "ParseMessageRef %s: %v", suffix, err)
+
+		_, err = ParseFeedRef(feed + suffix)
+		r.True(errors.Is(err, ErrNotACanonicalURI), "ParseFeedRef %s: %v", suffix, err)
+
+		var fr FeedRef
+		err = fr.UnmarshalText([]byte(feed + suffix))
+		r.True(errors.Is(err, ErrNotACanonicalURI), "FeedRef.UnmarshalText %s: %v", suffix, err)
+
+		var ar AnyRef
+		err = ar.UnmarshalJSON([]byte(`"` + msg + suffix + `"`))
+		r.True(errors.Is(err, ErrNotACanonicalURI), "AnyRef %s: %v", suffix, err)
+	}
+
+	_, err := ParseRef(msg)
+	r.NoError(err)
+	_, err = ParseFeedRef(feed)
+	r.NoError(err)
+}
+
+func TestParseURILenient(t *testing.T) {
+	const canonical = "ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w="
+
+	type tcase struct {
+		input      string
+		normalized bool
+	}
+
+	var cases = []tcase{
+		{canonical, false},
+		{"ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w", true},
+		{"ssb:message/sha256/g3hPVPDEO1Aj%2FuPl0%2BJ2NlhFB2bbFLIHlty%2BYuqFZ3w%3D", true},
+		{"ssb:message/sha256/g3hPVPDEO1Aj%2FuPl0+J2NlhFB2bbFLIHlty+YuqFZ3w=", true},
+		{"ssb:message/sha256/g3hPVPDEO1Aj%2fuPl0%2bJ2NlhFB2bbFLIHlty%2bYuqFZ3w", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			r := require.New(t)
+
+			got, normalized, err := ParseURILenient(tc.input)
+			r.NoError(err)
+			r.Equal(tc.normalized, normalized)
+			r.Equal(canonical, got.String())
+
+			// off by default
+			_, err = ParseURI(tc.input)
+			if tc.normalized {
+				r.Error(err)
+			} else {
+				r.NoError(err)
+			}
+		})
+	}
+
+	// still strict about length, type and format
+	var invalid = []string{
+		"ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2Ng",
+		"ssb:message/sha512/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w",
+		"ssb:message/sha256/g3hPVPDEO1Aj_uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w/",
+		"ssb:message/sha256/g3hPVPDEO1Aj*uPl0-J2NlhFB2bbFLIHlty-YuqFZ3w",
+		"ssb:message/sha256/g3hPVPDEO1Aj%2GuPl0-J2NlhFB2bbFLIHlty-YuqFZ3w",
+	}
+	for _, input := range invalid {
+		_, normalized, err := ParseURILenient(input)
+		var uriErr ErrInvalidCanonicalURI
+		require.True(t, errors.As(err, &uriErr), "%q: %v", input, err)
+		require.False(t, normalized)
+	}
 }
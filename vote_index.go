@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrVoteNoLink is returned by (*VoteIndex).Add for votes that don't link to a message
+var ErrVoteNoLink = errors.New("ssb/votes: vote without link")
+
+// VoteIndex tallies votes on messages, like the likes under a post.
+// An author's vote with the highest sequence replaces the earlier ones on the same message,
+// so a vote with value 0 takes back a like even if it is indexed before it.
+// The index can be used from multiple goroutines.
+type VoteIndex struct {
+	mu sync.RWMutex
+
+	votes  map[MessageRef]map[FeedRef]indexedVote
+	latest latestSequences
+}
+
+type indexedVote struct {
+	value      int
+	expression string
+}
+
+// NewVoteIndex returns an empty index
+func NewVoteIndex() *VoteIndex {
+	return &VoteIndex{
+		votes:  make(map[MessageRef]map[FeedRef]indexedVote),
+		latest: make(latestSequences),
+	}
+}
+
+// Add ingests a vote. It is ignored if the index already has a later vote of the same author on the same message.
+func (vi *VoteIndex) Add(vv ValueVote) error {
+	link := vv.Content.Vote.Link
+	if link == nil {
+		return ErrVoteNoLink
+	}
+
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+
+	if !vi.latest.advance(vv.Author, *link, vv.Sequence) {
+		return nil
+	}
+
+	byAuthor, has := vi.votes[*link]
+	if !has {
+		byAuthor = make(map[FeedRef]indexedVote)
+		vi.votes[*link] = byAuthor
+	}
+
+	byAuthor[vv.Author] = indexedVote{
+		value:      vv.Content.Vote.Value,
+		expression: vv.Content.Vote.Expression,
+	}
+	return nil
+}
+
+// Count returns the number of authors whose latest vote on the message is positive
+func (vi *VoteIndex) Count(link MessageRef) int {
+	vi.mu.RLock()
+	defer vi.mu.RUnlock()
+
+	n := 0
+	for _, v := range vi.votes[link] {
+		if v.value > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Expressions returns the positive votes on the message, counted by their expression
+func (vi *VoteIndex) Expressions(link MessageRef) map[string]int {
+	vi.mu.RLock()
+	defer vi.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, v := range vi.votes[link] {
+		if v.value > 0 {
+			counts[v.expression]++
+		}
+	}
+	return counts
+}
+
+// Voters returns the authors whose latest vote on the message is positive, sorted by sigil.
+func (vi *VoteIndex) Voters(link MessageRef) []FeedRef {
+	return vi.voters(link, func(v indexedVote) bool { return true })
+}
+
+// VotersWith is like Voters, but only for the votes with the passed expression.
+func (vi *VoteIndex) VotersWith(link MessageRef, expression string) []FeedRef {
+	return vi.voters(link, func(v indexedVote) bool { return v.expression == expression })
+}
+
+func (vi *VoteIndex) voters(link MessageRef, match func(indexedVote) bool) []FeedRef {
+	vi.mu.RLock()
+	defer vi.mu.RUnlock()
+
+	var feeds []FeedRef
+	for author, v := range vi.votes[link] {
+		if v.value > 0 && match(v) {
+			feeds = append(feeds, author)
+		}
+	}
+
+	return sortFeeds(feeds)
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2022 Henry Bubert
+//
+// SPDX-License-Identifier: MIT
+
+package refs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVoteIndex(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		alice  = newTestFeed('a')
+		bob    = newTestFeed('b')
+		claire = newTestFeed('c')
+	)
+
+	post, err := ParseMessageRef("%AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=.sha256")
+	r.NoError(err)
+	other, err := ParseMessageRef("%BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA=.sha256")
+	r.NoError(err)
+
+	vote := func(author FeedRef, seq int64, link MessageRef, value int, expression string) ValueVote {
+		var vv ValueVote
+		vv.Author = author
+		vv.Sequence = seq
+		vv.Content.Type = "vote"
+		vv.Content.Vote.Link = &link
+		vv.Content.Vote.Value = value
+		vv.Content.Vote.Expression = expression
+		return vv
+	}
+
+	vi := NewVoteIndex()
+
+	r.Equal(0, vi.Count(post))
+	r.Empty(vi.Voters(post))
+
+	r.NoError(vi.Add(vote(alice, 1, post, 1, "Like")))
+	r.NoError(vi.Add(vote(bob, 4, post, 1, "Like")))
+	r.NoError(vi.Add(vote(claire, 2, post, 1, "💜")))
+	r.NoError(vi.Add(vote(claire, 3, other, 1, "Like")))
+
+	r.Equal(3, vi.Count(post))
+	r.Equal(map[string]int{"Like": 2, "💜": 1}, vi.Expressions(post))
+	r.Equal(sortedBySigil(alice, bob, claire), vi.Voters(post))
+	r.Equal(sortedBySigil(alice, bob), vi.VotersWith(post, "Like"))
+	r.Equal(sortedBySigil(claire), vi.Voters(other))
+
+	// bob unvotes
+	r.NoError(vi.Add(vote(bob, 5, post, 0, "Unlike")))
+	r.Equal(2, vi.Count(post))
+	r.Equal(map[string]int{"Like": 1, "💜": 1}, vi.Expressions(post))
+	r.Equal(sortedBySigil(alice, claire), vi.Voters(post))
+
+	// an older vote arriving late doesn't undo the unvote
+	r.NoError(vi.Add(vote(bob, 3, post, 1, "Like")))
+	r.Equal(sortedBySigil(alice, claire), vi.Voters(post))
+
+	// the unvote of alice arrives before her vote
+	r.NoError(vi.Add(vote(alice, 7, other, 0, "Unlike")))
+	r.NoError(vi.Add(vote(alice, 6, other, 1, "Like")))
+	r.Equal(sortedBySigil(claire), vi.Voters(other))
+
+	var noLink ValueVote
+	noLink.Author = alice
+	noLink.Sequence = 8
+	err = vi.Add(noLink)
+	r.True(errors.Is(err, ErrVoteNoLink))
+}